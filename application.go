@@ -235,7 +235,20 @@ func (app *app) loop() {
 		}()
 	}
 
+	// progress is redrawn regularly so that stalled jobs are noticed
+	progressTicker := time.NewTicker(jobSpeedInterval)
+	defer progressTicker.Stop()
+
 	for {
+		// the question is delayed while the command line is in use so that
+		// typed input is not discarded
+		if app.nav.conflictQueued != "" && app.ui.cmdPrefix == "" {
+			app.nav.conflictPending = true
+			app.ui.cmdPrefix = "overwrite '" + app.nav.conflictQueued + "' ? [y/N/a/s] "
+			app.nav.conflictQueued = ""
+			app.ui.draw(app.nav)
+		}
+
 		select {
 		case <-app.quitChan:
 			if app.nav.copyTotal > 0 {
@@ -280,19 +293,13 @@ func (app *app) loop() {
 			return
 		case n := <-app.nav.copyBytesChan:
 			app.nav.copyBytes += n
-			// n is usually 4096B so update roughly per 4096B x 1024 = 4MB copied
-			if app.nav.copyUpdate++; app.nav.copyUpdate >= 1024 {
-				app.nav.copyUpdate = 0
-				app.ui.draw(app.nav)
-			}
+			// progress is sent in intervals so it can be drawn each time
+			app.ui.draw(app.nav)
 		case n := <-app.nav.copyTotalChan:
 			app.nav.copyTotal += n
 			if n < 0 {
 				app.nav.copyBytes += n
 			}
-			if app.nav.copyTotal == 0 {
-				app.nav.copyUpdate = 0
-			}
 			app.ui.draw(app.nav)
 		case n := <-app.nav.moveCountChan:
 			app.nav.moveCount += n
@@ -324,8 +331,14 @@ func (app *app) loop() {
 				app.nav.deleteUpdate = 0
 			}
 			app.ui.draw(app.nav)
+		case <-app.nav.sizeChan:
+			app.nav.sort()
+			app.ui.sort()
+			app.ui.loadFileInfo(app.nav)
+			app.ui.draw(app.nav)
+		case dst := <-app.nav.conflictChan:
+			app.nav.conflictQueued = dst
 		case d := <-app.nav.dirChan:
-
 			app.nav.checkDir(d)
 
 			if genOpts.dircache {
@@ -343,12 +356,14 @@ func (app *app) loop() {
 					app.nav.dirs[i] = d
 				}
 			}
+			app.nav.updateWatches()
 
 			app.nav.position()
 
 			curr, err := app.nav.currFile()
 			if err == nil {
 				if d.path == app.nav.currDir().path {
+					app.nav.autoDirSizes(app)
 					app.ui.loadFile(app, true)
 					if app.ui.msg == "" {
 						app.ui.loadFileInfo(app.nav)
@@ -360,6 +375,8 @@ func (app *app) loop() {
 			}
 
 			app.ui.draw(app.nav)
+		case paths := <-app.nav.watchChan:
+			app.nav.watchReload(paths)
 		case r := <-app.nav.regChan:
 			app.nav.checkReg(r)
 
@@ -403,6 +420,10 @@ func (app *app) loop() {
 			app.nav.renew()
 			app.ui.loadFile(app, false)
 			app.ui.draw(app.nav)
+		case <-progressTicker.C:
+			if app.nav.jobs.find((*job).hasProgress) != nil {
+				app.ui.draw(app.nav)
+			}
 		}
 	}
 }
@@ -418,6 +439,7 @@ func (app *app) loop() {
 func (app *app) runShell(s string, args []string, prefix string) {
 	app.nav.exportFiles()
 	app.ui.exportSizes()
+	app.nav.exportProgress()
 	exportOpts()
 
 	cmd := shellCommand(s, args)
@@ -525,8 +547,30 @@ func (app *app) runShell(s string, args []string, prefix string) {
 	}
 }
 
-func loadFiles() (list []string, cp bool, err error) {
-	files, err := os.Open(genFilesPath)
+// registerPath returns the path of the file holding the files of the given
+// register. The unnamed register is the copy/cut buffer.
+func registerPath(reg string) string {
+	if reg == "" {
+		return genFilesPath
+	}
+	return filepath.Join(filepath.Dir(genFilesPath), "registers", reg)
+}
+
+// registerArg returns the register given as the first argument of a command,
+// or the unnamed register if none is given. Named registers are single
+// lowercase letters and '"' is the unnamed register as in vim.
+func registerArg(args []string) (string, error) {
+	if len(args) == 0 || args[0] == `"` {
+		return "", nil
+	}
+	if len(args[0]) != 1 || args[0][0] < 'a' || args[0][0] > 'z' {
+		return "", fmt.Errorf("invalid register: %s", args[0])
+	}
+	return args[0], nil
+}
+
+func loadFiles(reg string) (list []string, cp bool, err error) {
+	files, err := os.Open(registerPath(reg))
 	if os.IsNotExist(err) {
 		err = nil
 		return
@@ -565,12 +609,13 @@ func loadFiles() (list []string, cp bool, err error) {
 	return
 }
 
-func saveFiles(list []string, cp bool) error {
-	if err := os.MkdirAll(filepath.Dir(genFilesPath), os.ModePerm); err != nil {
+func saveFiles(reg string, list []string, cp bool) error {
+	path := registerPath(reg)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
 		return fmt.Errorf("creating data directory: %s", err)
 	}
 
-	files, err := os.Create(genFilesPath)
+	files, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("opening file selections file: %s", err)
 	}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveFormat returns the format of the archive with the given name, which is
+// either 'tar', 'tar.gz' or 'zip', or an empty string if it is not supported.
+func archiveFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+// archiveSize returns the number of bytes processed while extracting the given
+// archive, or only the entries with the given prefix when it is not empty.
+// Compressed size is used for tar archives as they are read as a stream, and
+// uncompressed size is used for zip archives.
+func archiveSize(path, prefix string) (int64, error) {
+	if archiveFormat(path) != "zip" {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		return stat.Size(), nil
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var total int64
+	for _, f := range r.File {
+		if _, ok := archiveEntryName(f.Name, prefix); ok {
+			total += int64(f.UncompressedSize64)
+		}
+	}
+
+	return total, nil
+}
+
+// safeJoin joins the given directory and the given archive entry name, and
+// returns an error if the result is outside of the directory. This prevents
+// entries such as '../foo' or '/foo' to be extracted elsewhere.
+func safeJoin(dir, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%s: absolute path in archive", name)
+	}
+
+	path := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: path escapes the target directory", name)
+	}
+
+	return path, nil
+}
+
+// checkInside returns an error if the given directory resolves to a path that
+// is outside of the given root. This prevents symbolic links extracted earlier
+// from being used to write files elsewhere.
+func checkInside(root, dir string) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: path escapes the target directory", dir)
+	}
+
+	return nil
+}
+
+// mkdirInside creates the given directory and its missing parents inside the
+// given root directory. Each existing component is checked before anything is
+// created below it, so that symbolic links extracted before can not be used to
+// create directories outside of the root directory.
+func mkdirInside(root, dir string) error {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	path := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, name)
+
+		lstat, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(path, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if lstat.Mode()&os.ModeSymlink != 0 {
+			if err := checkInside(root, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// countReader reports the number of bytes read from the underlying reader as
+// progress.
+type countReader struct {
+	r io.Reader
+	p *copyProgress
+}
+
+func (c *countReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.p.add(int64(n))
+	return n, err
+}
+
+// archiveAll creates an archive at the given path containing the given sources
+// with their base names. The format is decided by the extension of the path.
+// The archive is removed if the job is cancelled.
+func archiveAll(path string, srcs []string, j *job) (nums chan int64, errs chan error) {
+	nums = make(chan int64, 1024)
+	errs = make(chan error, 1024)
+
+	p := newCopyProgress(nums)
+
+	go func() {
+		defer close(errs)
+		defer p.flush()
+
+		format := archiveFormat(path)
+		if format == "" {
+			errs <- fmt.Errorf("archive: %s: unsupported format", path)
+			return
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+		if err != nil {
+			errs <- fmt.Errorf("archive: %s", err)
+			return
+		}
+
+		var add func(path, name string, info os.FileInfo) error
+		var closeArchive func() error
+
+		switch format {
+		case "zip":
+			w := zip.NewWriter(f)
+			add = func(path, name string, info os.FileInfo) error {
+				return addZip(w, path, name, info, p, j)
+			}
+			closeArchive = w.Close
+		default:
+			var gw *gzip.Writer
+			var tw *tar.Writer
+			if format == "tar.gz" {
+				gw = gzip.NewWriter(f)
+				tw = tar.NewWriter(gw)
+			} else {
+				tw = tar.NewWriter(f)
+			}
+			add = func(path, name string, info os.FileInfo) error {
+				return addTar(tw, path, name, info, p, j)
+			}
+			closeArchive = func() error {
+				if err := tw.Close(); err != nil {
+					return err
+				}
+				if gw != nil {
+					return gw.Close()
+				}
+				return nil
+			}
+		}
+
+		for _, src := range srcs {
+			if j.isCancelled() {
+				break
+			}
+
+			base := filepath.Dir(src)
+			filepath.Walk(src, func(walkPath string, info os.FileInfo, err error) error {
+				if err := j.check(); err != nil {
+					return filepath.SkipAll
+				}
+				if err != nil {
+					errs <- fmt.Errorf("walk: %s", err)
+					return nil
+				}
+				if walkPath == path {
+					return nil
+				}
+				rel, err := filepath.Rel(base, walkPath)
+				if err != nil {
+					errs <- fmt.Errorf("relative: %s", err)
+					return nil
+				}
+				j.setFile(walkPath)
+				if err := add(walkPath, filepath.ToSlash(rel), info); err == errJobCancelled {
+					return filepath.SkipAll
+				} else if err != nil {
+					errs <- fmt.Errorf("archive: %s", err)
+				}
+				return nil
+			})
+		}
+
+		if err := closeArchive(); err != nil && !j.isCancelled() {
+			errs <- fmt.Errorf("archive: %s", err)
+		}
+		if err := f.Close(); err != nil && !j.isCancelled() {
+			errs <- fmt.Errorf("archive: %s", err)
+		}
+
+		if j.isCancelled() {
+			os.Remove(path)
+		}
+	}()
+
+	return nums, errs
+}
+
+func addTar(w *tar.Writer, path, name string, info os.FileInfo, p *copyProgress, j *job) error {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	} else if !info.Mode().IsRegular() && !info.IsDir() {
+		// special files are skipped as in copying
+		p.add(info.Size())
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := w.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		p.add(info.Size())
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return copyBuffer(w, f, p, j)
+}
+
+func addZip(w *zip.Writer, path, name string, info os.FileInfo, p *copyProgress, j *job) error {
+	if !info.Mode().IsRegular() && !info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+		// special files are skipped as in copying
+		p.add(info.Size())
+		return nil
+	}
+
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	} else if info.Mode().IsRegular() {
+		hdr.Method = zip.Deflate
+	}
+
+	fw, err := w.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		p.add(info.Size())
+		return nil
+	case info.Mode()&os.ModeSymlink != 0:
+		// symbolic links are stored with their targets as contents
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		p.add(info.Size())
+		_, err = io.WriteString(fw, link)
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return copyBuffer(fw, f, p, j)
+}
+
+// archiveEntry is a single file in an archive to be extracted.
+type archiveEntry struct {
+	name string
+	info os.FileInfo
+	link string
+	open func() (io.ReadCloser, error)
+}
+
+// extractAll extracts the archive at the given path into the given directory.
+// When the given prefix is not empty, only the entry with this name and the
+// entries inside it are extracted, and the target is the path of the extracted
+// entry instead. Entries with paths outside of the directory are rejected.
+// Existing files are handled according to the 'pasteconflict' option, using the
+// given function to decide whether they should be replaced.
+func extractAll(path, prefix, target string, replace conflictFunc, j *job) (nums chan int64, errs chan error) {
+	nums = make(chan int64, 1024)
+	errs = make(chan error, 1024)
+
+	p := newCopyProgress(nums)
+	conflict := genOpts.pasteconflict
+
+	go func() {
+		defer close(errs)
+		defer p.flush()
+
+		dir := target
+		if prefix != "" {
+			dir = filepath.Dir(target)
+		}
+
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			errs <- fmt.Errorf("extract: %s", err)
+			return
+		}
+
+		// entry contents are copied without progress when the progress is
+		// reported by reading the archive itself
+		extract := func(e *archiveEntry, p *copyProgress) error {
+			name, ok := archiveEntryName(e.name, prefix)
+			if !ok {
+				return nil
+			}
+			j.setFile(e.name)
+			if prefix != "" {
+				name = filepath.Join(filepath.Base(target), filepath.FromSlash(name))
+			}
+
+			dst, err := safeJoin(root, name)
+			if err != nil {
+				return err
+			}
+			if dst == root {
+				return nil
+			}
+
+			if err := mkdirInside(root, filepath.Dir(dst)); err != nil {
+				return err
+			}
+
+			if dstInfo, err := os.Lstat(dst); err == nil && !(e.info.IsDir() && dstInfo.IsDir()) {
+				if conflict == "rename" {
+					dst = numberedPath(dst)
+				} else if replace == nil || !replace(e.info, dst) {
+					return nil
+				} else if err := os.RemoveAll(dst); err != nil {
+					return err
+				}
+			}
+
+			mode := e.info.Mode()
+			switch {
+			case mode.IsDir():
+				return os.MkdirAll(dst, mode.Perm()|0o700)
+			case mode&os.ModeSymlink != 0:
+				return os.Symlink(e.link, dst)
+			case !mode.IsRegular():
+				return nil
+			}
+
+			r, err := e.open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+			if err != nil {
+				return err
+			}
+
+			if err := copyBuffer(w, r, p, j); err != nil {
+				w.Close()
+				os.Remove(dst)
+				return err
+			}
+			if err := w.Close(); err != nil {
+				return err
+			}
+
+			return os.Chtimes(dst, e.info.ModTime(), e.info.ModTime())
+		}
+
+		switch archiveFormat(path) {
+		case "zip":
+			err = extractZip(path, prefix, extract, p, j, errs)
+		case "tar", "tar.gz":
+			err = extractTar(path, extract, p, j, errs)
+		default:
+			err = fmt.Errorf("%s: unsupported format", path)
+		}
+		if err != nil && err != errJobCancelled {
+			errs <- fmt.Errorf("extract: %s", err)
+		}
+	}()
+
+	return nums, errs
+}
+
+func extractZip(path, prefix string, extract func(*archiveEntry, *copyProgress) error, p *copyProgress, j *job, errs chan error) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err := j.check(); err != nil {
+			return err
+		}
+
+		// skipped entries are not counted in the archive size
+		if _, ok := archiveEntryName(f.Name, prefix); !ok {
+			continue
+		}
+
+		e := &archiveEntry{name: f.Name, info: f.FileInfo(), open: f.Open}
+		if e.info.Mode()&os.ModeSymlink != 0 {
+			if e.link, err = readZipLink(f); err != nil {
+				errs <- fmt.Errorf("extract: %s", err)
+				continue
+			}
+		}
+
+		if err := extract(e, p); err == errJobCancelled {
+			return err
+		} else if err != nil {
+			errs <- fmt.Errorf("extract: %s", err)
+			p.add(int64(f.UncompressedSize64))
+		} else if !e.info.Mode().IsRegular() {
+			p.add(int64(f.UncompressedSize64))
+		}
+	}
+
+	return nil
+}
+
+func readZipLink(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, 4096))
+	return string(b), err
+}
+
+func extractTar(path string, extract func(*archiveEntry, *copyProgress) error, p *copyProgress, j *job, errs chan error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// progress is the number of bytes read from the archive file
+	var r io.Reader = &countReader{f, p}
+	if archiveFormat(path) == "tar.gz" {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		if err := j.check(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		e := &archiveEntry{
+			name: hdr.Name,
+			info: hdr.FileInfo(),
+			link: hdr.Linkname,
+			open: func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			errs <- fmt.Errorf("extract: %s: hard links are not supported", hdr.Name)
+			continue
+		}
+
+		if err := extract(e, nil); err == errJobCancelled {
+			return err
+		} else if err != nil {
+			errs <- fmt.Errorf("extract: %s", err)
+		}
+	}
+}
+
+// archiveAsync creates an archive at the given path containing the given
+// sources while showing the progress in the ruler.
+func (nav *nav) archiveAsync(app *app, srcs []string, path string) {
+	echo := &callExpr{"echoerr", []string{""}, 1}
+
+	j := nav.jobs.add("archive", path)
+	defer nav.jobs.remove(j)
+
+	errCount := 0
+	total, err := copySize(srcs)
+	if err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+		app.ui.exprChan <- echo
+		return
+	}
+
+	nums, errs := archiveAll(path, srcs, j)
+	errCount = nav.progressWait(app, j, total, nums, errs, echo, errCount)
+
+	if genSingleMode {
+		nav.renew()
+		app.ui.loadFile(app, true)
+	} else {
+		if err := remote("send load"); err != nil {
+			errCount++
+			echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+			app.ui.exprChan <- echo
+		}
+	}
+
+	if j.isCancelled() {
+		app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+	} else if errCount == 0 {
+		app.ui.exprChan <- &callExpr{"echo", []string{"\033[0;32mArchived successfully\033[0m"}, 1}
+	}
+}
+
+// extractAsync extracts the archive at the given path into the given directory
+// while showing the progress in the ruler.
+func (nav *nav) extractAsync(app *app, path, dir string) {
+	echo := &callExpr{"echoerr", []string{""}, 1}
+
+	j := nav.jobs.add("extract", dir)
+	defer nav.jobs.remove(j)
+
+	errCount := 0
+	total, err := archiveSize(path, "")
+	if err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+		app.ui.exprChan <- echo
+		return
+	}
+
+	nums, errs := extractAll(path, "", dir, nav.conflictFunc(), j)
+	errCount = nav.progressWait(app, j, total, nums, errs, echo, errCount)
+
+	if genSingleMode {
+		nav.renew()
+		app.ui.loadFile(app, true)
+	} else {
+		if err := remote("send load"); err != nil {
+			errCount++
+			echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+			app.ui.exprChan <- echo
+		}
+	}
+
+	if j.isCancelled() {
+		app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+	} else if errCount == 0 {
+		app.ui.exprChan <- &callExpr{"echo", []string{"\033[0;32mExtracted successfully\033[0m"}, 1}
+	}
+}
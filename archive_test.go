@@ -0,0 +1,165 @@
+package main
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	dir := filepath.FromSlash("/tmp/dir")
+
+	tests := []struct {
+		name string
+		exp  string
+		ok   bool
+	}{
+		{"foo", filepath.Join(dir, "foo"), true},
+		{"foo/bar", filepath.Join(dir, "foo", "bar"), true},
+		{"foo/../bar", filepath.Join(dir, "bar"), true},
+		{"./foo", filepath.Join(dir, "foo"), true},
+		{"..foo", filepath.Join(dir, "..foo"), true},
+		{"../foo", "", false},
+		{"foo/../../bar", "", false},
+		{"..", "", false},
+		{"/etc/passwd", "", false},
+	}
+
+	for _, test := range tests {
+		got, err := safeJoin(dir, test.name)
+		if (err == nil) != test.ok || got != test.exp {
+			t.Errorf("at input '%s' expected '%s' but got '%s' with error '%v'", test.name, test.exp, got, err)
+		}
+	}
+}
+
+func TestArchiveAll(t *testing.T) {
+	for _, ext := range []string{".tar", ".tar.gz", ".zip"} {
+		tmp := t.TempDir()
+
+		src := filepath.Join(tmp, "src")
+		if err := os.MkdirAll(filepath.Join(src, "dir"), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{"a": "foo", filepath.Join("dir", "b"): "bar"}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(src, name), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Symlink("a", filepath.Join(src, "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(tmp, "archive"+ext)
+		_, errs := waitProgress(archiveAll(path, []string{src}, nil))
+		for _, err := range errs {
+			t.Errorf("at format '%s' archiving: %s", ext, err)
+		}
+
+		dst := filepath.Join(tmp, "dst")
+		if err := os.Mkdir(dst, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		_, errs = waitProgress(extractAll(path, "", dst, nil, nil))
+		for _, err := range errs {
+			t.Errorf("at format '%s' extracting: %s", ext, err)
+		}
+
+		for name, data := range files {
+			b, err := os.ReadFile(filepath.Join(dst, "src", name))
+			if err != nil {
+				t.Errorf("at format '%s' reading '%s': %s", ext, name, err)
+				continue
+			}
+			if string(b) != data {
+				t.Errorf("at format '%s' expected file '%s' to have '%s' but got '%s'", ext, name, data, b)
+			}
+		}
+
+		if target, err := os.Readlink(filepath.Join(dst, "src", "link")); err != nil || target != "a" {
+			t.Errorf("at format '%s' expected link target 'a' but got '%s' with error '%v'", ext, target, err)
+		}
+	}
+}
+
+func TestExtractAllUnsafe(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := filepath.Join(tmp, "evil.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := tar.NewWriter(f)
+	entries := []*tar.Header{
+		{Name: "../escape", Mode: 0o644, Typeflag: tar.TypeReg},
+		{Name: "link", Linkname: tmp, Mode: 0o777, Typeflag: tar.TypeSymlink},
+		{Name: "link/escape", Mode: 0o644, Typeflag: tar.TypeReg},
+	}
+	for _, hdr := range entries {
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dst := filepath.Join(tmp, "dst")
+	if err := os.Mkdir(dst, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, errs := waitProgress(extractAll(path, "", dst, nil, nil)); len(errs) != 2 {
+		t.Errorf("expected 2 errors but got '%v'", errs)
+	}
+	if _, err := os.Lstat(filepath.Join(tmp, "escape")); !os.IsNotExist(err) {
+		t.Errorf("file should not be extracted outside of the target directory")
+	}
+}
+
+func TestExtractAllUnsafeParents(t *testing.T) {
+	tmp := t.TempDir()
+
+	outside := filepath.Join(tmp, "outside")
+	if err := os.Mkdir(outside, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tmp, "evil.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := tar.NewWriter(f)
+	entries := []*tar.Header{
+		{Name: "l", Linkname: outside, Mode: 0o777, Typeflag: tar.TypeSymlink},
+		{Name: "l/a/b/f", Mode: 0o644, Typeflag: tar.TypeReg},
+	}
+	for _, hdr := range entries {
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dst := filepath.Join(tmp, "dst")
+	if err := os.Mkdir(dst, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, errs := waitProgress(extractAll(path, "", dst, nil, nil)); len(errs) != 1 {
+		t.Errorf("expected 1 error but got '%v'", errs)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "a")); !os.IsNotExist(err) {
+		t.Errorf("parent directories should not be created outside of the target directory")
+	}
+}
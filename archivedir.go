@@ -0,0 +1,528 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveTree is the index of the entries in an archive used to browse the
+// archive as a directory. Directories that are not stored in the archive but
+// contain stored entries are added to the index as well.
+type archiveTree struct {
+	modTime  time.Time
+	size     int64
+	infos    map[string]os.FileInfo   // entries by their cleaned names
+	children map[string][]os.FileInfo // entries by their parent directories
+	links    map[string]string        // targets of symbolic links
+}
+
+var archiveCache = struct {
+	mutex sync.Mutex
+	trees map[string]*archiveTree
+}{trees: make(map[string]*archiveTree)}
+
+// virtualDirInfo is the file information of a directory that does not exist on
+// disk, such as a directory that is not stored in an archive.
+type virtualDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (i *virtualDirInfo) Name() string       { return i.name }
+func (i *virtualDirInfo) Size() int64        { return 0 }
+func (i *virtualDirInfo) Mode() os.FileMode  { return os.ModeDir | 0o755 }
+func (i *virtualDirInfo) ModTime() time.Time { return i.modTime }
+func (i *virtualDirInfo) IsDir() bool        { return true }
+func (i *virtualDirInfo) Sys() any           { return nil }
+
+// cleanEntryName returns the given archive entry name without leading and
+// trailing slashes and relative elements, or an empty string for the root.
+func cleanEntryName(name string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// isArchive returns true if the file is an archive that can be browsed as a
+// directory.
+func (file *file) isArchive() bool {
+	return genOpts.archivedirs && file.Mode().IsRegular() && archiveFormat(file.path) != ""
+}
+
+// browsable returns true if the file can be opened as a directory.
+func (file *file) browsable() bool {
+	return file.IsDir() || file.isArchive()
+}
+
+// splitArchivePath splits the given path into the path of an archive file and
+// the name of an entry in the archive. It returns false if the path is not
+// inside an archive. The archive itself is returned with an empty entry name.
+func splitArchivePath(p string) (archive, name string, ok bool) {
+	for curr := filepath.Clean(p); ; curr = filepath.Dir(curr) {
+		if archiveFormat(curr) != "" {
+			if stat, err := os.Stat(curr); err == nil && stat.Mode().IsRegular() {
+				rel, err := filepath.Rel(curr, p)
+				if err != nil {
+					return "", "", false
+				}
+				return curr, cleanEntryName(rel), true
+			}
+		}
+		if filepath.Dir(curr) == curr {
+			return "", "", false
+		}
+	}
+}
+
+// statDir returns the information of the given directory, or the information of
+// the archive for directories inside archives. Listings are reported with the
+// time they were last marked as modified.
+func statDir(dir string) (os.FileInfo, error) {
+	if l, ok := getListing(dir); ok {
+		return &virtualDirInfo{filepath.Base(dir), listingModTime(l)}, nil
+	}
+	if archive, _, ok := splitArchivePath(dir); ok {
+		return os.Stat(archive)
+	}
+	return os.Stat(dir)
+}
+
+// workDir returns the directory used as the working directory for the given
+// directory. Directories inside archives and listings can not be the working
+// directory, so the directory of the archive or the listing is used instead.
+func workDir(dir string) string {
+	if l, ok := getListing(dir); ok {
+		return l.dir
+	}
+	if archive, _, ok := splitArchivePath(dir); ok {
+		return filepath.Dir(archive)
+	}
+	return dir
+}
+
+// chdir changes the working directory to the working directory of the given
+// directory.
+func chdir(dir string) error {
+	return os.Chdir(workDir(dir))
+}
+
+// archiveEntryName returns the name of the given archive entry relative to the
+// given entry prefix, and false if the entry is not the prefix itself or inside
+// of it. The name is returned unchanged when the prefix is empty.
+func archiveEntryName(name, prefix string) (string, bool) {
+	if prefix == "" {
+		return name, true
+	}
+	name = cleanEntryName(name)
+	if name == prefix {
+		return "", true
+	}
+	if strings.HasPrefix(name, prefix+"/") {
+		return name[len(prefix)+1:], true
+	}
+	return "", false
+}
+
+// isArchivePath returns true if the given path is inside an archive.
+func isArchivePath(p string) bool {
+	_, name, ok := splitArchivePath(p)
+	return ok && name != ""
+}
+
+// checkArchivePaths returns an error if any of the given paths is inside an
+// archive. Archives are read-only, and removing or changing their virtual paths
+// would otherwise seem to succeed without doing anything.
+func checkArchivePaths(paths []string) error {
+	for _, p := range paths {
+		if isArchivePath(p) {
+			return errors.New("archives are read-only")
+		}
+	}
+	return nil
+}
+
+// loadArchiveTree returns the index of the given archive, which is read again
+// only when the archive is modified.
+func loadArchiveTree(archive string) (*archiveTree, error) {
+	stat, err := os.Stat(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveCache.mutex.Lock()
+	defer archiveCache.mutex.Unlock()
+
+	if t, ok := archiveCache.trees[archive]; ok && t.modTime.Equal(stat.ModTime()) && t.size == stat.Size() {
+		return t, nil
+	}
+
+	t := &archiveTree{
+		modTime:  stat.ModTime(),
+		size:     stat.Size(),
+		infos:    make(map[string]os.FileInfo),
+		children: make(map[string][]os.FileInfo),
+		links:    make(map[string]string),
+	}
+
+	add := func(name string, info os.FileInfo, link string) {
+		name = cleanEntryName(name)
+		if name == "" {
+			return
+		}
+		if _, ok := t.infos[name]; ok {
+			return
+		}
+
+		// parent directories are added first so that they are listed once
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if _, ok := t.infos[parent]; ok {
+				break
+			}
+			dirInfo := &virtualDirInfo{path.Base(parent), stat.ModTime()}
+			t.infos[parent] = dirInfo
+			t.children[cleanEntryName(path.Dir(parent))] = append(t.children[cleanEntryName(path.Dir(parent))], dirInfo)
+		}
+
+		t.infos[name] = info
+		t.children[cleanEntryName(path.Dir(name))] = append(t.children[cleanEntryName(path.Dir(name))], info)
+		if link != "" {
+			t.links[name] = link
+		}
+	}
+
+	switch archiveFormat(archive) {
+	case "zip":
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			add(f.Name, f.FileInfo(), "")
+		}
+	case "tar", "tar.gz":
+		f, err := os.Open(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var r io.Reader = f
+		if archiveFormat(archive) == "tar.gz" {
+			gr, err := gzip.NewReader(f)
+			if err != nil {
+				return nil, err
+			}
+			defer gr.Close()
+			r = gr
+		}
+
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			add(hdr.Name, hdr.FileInfo(), hdr.Linkname)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported archive format", archive)
+	}
+
+	archiveCache.trees[archive] = t
+
+	return t, nil
+}
+
+// archiveLstat returns the information of the file at the given path inside an
+// archive.
+func archiveLstat(p string) (os.FileInfo, error) {
+	archive, name, ok := splitArchivePath(p)
+	if !ok || name == "" {
+		return os.Lstat(p)
+	}
+
+	t, err := loadArchiveTree(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := t.infos[name]
+	if !ok {
+		return nil, &os.PathError{Op: "lstat", Path: p, Err: os.ErrNotExist}
+	}
+
+	return info, nil
+}
+
+// walkEntries is similar to filepath.Walk but the given root may also be a path
+// inside an archive, in which case the entries of the archive under it are
+// walked without extracting them.
+func walkEntries(root string, fn filepath.WalkFunc) error {
+	archive, name, ok := splitArchivePath(root)
+	if !ok || name == "" {
+		return filepath.Walk(root, fn)
+	}
+
+	t, err := loadArchiveTree(archive)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	info, ok := t.infos[name]
+	if !ok {
+		return fn(root, nil, &os.PathError{Op: "lstat", Path: root, Err: os.ErrNotExist})
+	}
+
+	var walk func(p, entry string, info os.FileInfo) error
+	walk = func(p, entry string, info os.FileInfo) error {
+		if err := fn(p, info, nil); err != nil {
+			if err == filepath.SkipDir && info.IsDir() {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		for _, child := range t.children[entry] {
+			err := walk(filepath.Join(p, child.Name()), path.Join(entry, child.Name()), child)
+			if err == filepath.SkipDir {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, name, info); err != filepath.SkipDir && err != filepath.SkipAll {
+		return err
+	}
+	return nil
+}
+
+// readArchiveDir returns the files in the directory at the given path inside an
+// archive, or at the root of the archive when the path is the archive itself.
+func readArchiveDir(archive, name string) ([]*file, error) {
+	t, err := loadArchiveTree(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, ok := t.infos[name]; name != "" && (!ok || !info.IsDir()) {
+		return nil, &os.PathError{Op: "open", Path: filepath.Join(archive, name), Err: errors.New("not a directory")}
+	}
+
+	infos := t.children[name]
+	files := make([]*file, 0, len(infos))
+	for _, info := range infos {
+		entry := path.Join(name, info.Name())
+
+		var linkState linkState
+		linkTarget := t.links[entry]
+		if info.Mode()&os.ModeSymlink != 0 {
+			linkState = broken
+			if _, ok := t.infos[cleanEntryName(path.Join(path.Dir(entry), linkTarget))]; ok {
+				linkState = working
+			}
+		}
+
+		dirCount := -1
+		if info.IsDir() && genOpts.dircounts {
+			dirCount = len(t.children[entry])
+		}
+
+		files = append(files, &file{
+			FileInfo:   info,
+			linkState:  linkState,
+			linkTarget: linkTarget,
+			path:       filepath.Join(archive, filepath.FromSlash(entry)),
+			dirCount:   dirCount,
+			accessTime: info.ModTime(),
+			changeTime: info.ModTime(),
+			ext:        filepath.Ext(info.Name()),
+		})
+	}
+
+	return files, nil
+}
+
+type archiveEntryReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *archiveEntryReader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if e := r.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// openArchiveEntry opens the regular file at the given path inside an archive
+// for reading.
+func openArchiveEntry(p string) (io.ReadCloser, error) {
+	archive, name, ok := splitArchivePath(p)
+	if !ok || name == "" {
+		return os.Open(p)
+	}
+
+	notFound := &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+
+	if archiveFormat(archive) == "zip" {
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range r.File {
+			if cleanEntryName(f.Name) == name && f.FileInfo().Mode().IsRegular() {
+				rc, err := f.Open()
+				if err != nil {
+					r.Close()
+					return nil, err
+				}
+				return &archiveEntryReader{rc, []io.Closer{r, rc}}, nil
+			}
+		}
+		r.Close()
+		return nil, notFound
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	closers := []io.Closer{f}
+	var r io.Reader = f
+	if archiveFormat(archive) == "tar.gz" {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		closers = append(closers, gr)
+		r = gr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			(&archiveEntryReader{nil, closers}).Close()
+			if err == io.EOF {
+				return nil, notFound
+			}
+			return nil, err
+		}
+		if cleanEntryName(hdr.Name) == name && hdr.FileInfo().Mode().IsRegular() {
+			return &archiveEntryReader{tr, closers}, nil
+		}
+	}
+}
+
+// copyEntriesSize is similar to copySize but the sources may also be files
+// inside archives.
+func copyEntriesSize(srcs []string) (int64, error) {
+	var files []string
+	var total int64
+
+	for _, src := range srcs {
+		if !isArchivePath(src) {
+			files = append(files, src)
+			continue
+		}
+
+		archive, name, _ := splitArchivePath(src)
+		size, err := archiveSize(archive, name)
+		if err != nil {
+			return total, err
+		}
+		total += size
+	}
+
+	size, err := copySize(files)
+
+	return total + size, err
+}
+
+// copyEntries is similar to copyAll but the sources may also be files inside
+// archives, which are extracted to their destinations after the other sources
+// are copied.
+func copyEntries(srcs, dsts []string, replace conflictFunc, j *job) (nums chan int64, errs chan error) {
+	var files, fileDsts, entries, entryDsts []string
+	for i, src := range srcs {
+		if isArchivePath(src) {
+			entries = append(entries, src)
+			entryDsts = append(entryDsts, dsts[i])
+		} else {
+			files = append(files, src)
+			fileDsts = append(fileDsts, dsts[i])
+		}
+	}
+
+	if len(entries) == 0 {
+		return copyAll(srcs, dsts, replace, j)
+	}
+
+	nums = make(chan int64, 1024)
+	errs = make(chan error, 1024)
+
+	forward := func(n chan int64, e chan error) {
+		for {
+			select {
+			case x := <-n:
+				nums <- x
+			case err, ok := <-e:
+				if ok {
+					errs <- err
+					continue
+				}
+				// progress sent right before closing the error channel may remain
+				for {
+					select {
+					case x := <-n:
+						nums <- x
+					default:
+						return
+					}
+				}
+			}
+		}
+	}
+
+	go func() {
+		defer close(errs)
+
+		if len(files) != 0 {
+			forward(copyAll(files, fileDsts, replace, j))
+		}
+
+		for i, src := range entries {
+			if j.check() != nil {
+				return
+			}
+			archive, name, _ := splitArchivePath(src)
+			forward(extractAll(archive, name, entryDsts[i], replace, j))
+		}
+	}()
+
+	return nums, errs
+}
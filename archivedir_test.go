@@ -0,0 +1,220 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTestArchive creates an archive at the given path with a file 'a' and a
+// file 'dir/b' whose parent directory is not stored in the archive.
+func writeTestArchive(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	entries := []struct{ name, data string }{{"a", "foo"}, {"dir/b", "bar"}}
+
+	if archiveFormat(path) == "zip" {
+		w := zip.NewWriter(f)
+		for _, e := range entries {
+			fw, err := w.Create(e.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(fw, e.data)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	var fw io.Writer = f
+	if archiveFormat(path) == "tar.gz" {
+		gw := gzip.NewWriter(f)
+		defer gw.Close()
+		fw = gw
+	}
+
+	w := tar.NewWriter(fw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, e.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitArchivePath(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := filepath.Join(tmp, "foo.zip")
+	writeTestArchive(t, path)
+	if err := os.Mkdir(filepath.Join(tmp, "bar.tar"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		archive string
+		name    string
+		ok      bool
+	}{
+		{tmp, "", "", false},
+		{path, path, "", true},
+		{filepath.Join(path, "a"), path, "a", true},
+		{filepath.Join(path, "dir", "b"), path, "dir/b", true},
+		{filepath.Join(tmp, "bar.tar"), "", "", false},
+		{filepath.Join(tmp, "bar.tar", "baz"), "", "", false},
+	}
+
+	for _, test := range tests {
+		archive, name, ok := splitArchivePath(test.path)
+		if archive != test.archive || name != test.name || ok != test.ok {
+			t.Errorf("at input '%s' expected '%s', '%s', '%t' but got '%s', '%s', '%t'",
+				test.path, test.archive, test.name, test.ok, archive, name, ok)
+		}
+	}
+}
+
+func TestCheckArchivePaths(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := filepath.Join(tmp, "foo.zip")
+	writeTestArchive(t, path)
+
+	tests := []struct {
+		paths []string
+		err   bool
+	}{
+		{[]string{tmp, path}, false},
+		{[]string{tmp, filepath.Join(path, "a")}, true},
+		{[]string{filepath.Join(path, "dir", "b")}, true},
+	}
+
+	for _, test := range tests {
+		if err := checkArchivePaths(test.paths); (err != nil) != test.err {
+			t.Errorf("at input '%v' expected error '%t' but got '%v'", test.paths, test.err, err)
+		}
+	}
+}
+
+func TestReadArchiveDir(t *testing.T) {
+	for _, ext := range []string{".tar", ".zip"} {
+		path := filepath.Join(t.TempDir(), "archive"+ext)
+		writeTestArchive(t, path)
+
+		tests := []struct {
+			dir string
+			exp []string
+		}{
+			{path, []string{"a", "dir"}},
+			{filepath.Join(path, "dir"), []string{"b"}},
+		}
+
+		for _, test := range tests {
+			files, err := readdir(test.dir)
+			if err != nil {
+				t.Errorf("at format '%s' reading '%s': %s", ext, test.dir, err)
+				continue
+			}
+
+			var got []string
+			for _, f := range files {
+				got = append(got, f.Name())
+				if f.path != filepath.Join(test.dir, f.Name()) {
+					t.Errorf("at format '%s' expected path '%s' but got '%s'", ext, filepath.Join(test.dir, f.Name()), f.path)
+				}
+			}
+			sort.Strings(got)
+
+			if strings.Join(got, " ") != strings.Join(test.exp, " ") {
+				t.Errorf("at format '%s' reading '%s' expected '%v' but got '%v'", ext, test.dir, test.exp, got)
+			}
+		}
+
+		r, err := openArchiveEntry(filepath.Join(path, "dir", "b"))
+		if err != nil {
+			t.Errorf("at format '%s' opening entry: %s", ext, err)
+			continue
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(b) != "bar" {
+			t.Errorf("at format '%s' expected entry to have 'bar' but got '%s' with error '%v'", ext, b, err)
+		}
+	}
+}
+
+func TestCopyEntries(t *testing.T) {
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		tmp := t.TempDir()
+
+		path := filepath.Join(tmp, "archive"+ext)
+		writeTestArchive(t, path)
+
+		regular := filepath.Join(tmp, "c")
+		if err := os.WriteFile(regular, []byte("baz"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := filepath.Join(tmp, "dst")
+		if err := os.Mkdir(dst, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		srcs := []string{filepath.Join(path, "a"), filepath.Join(path, "dir"), regular}
+		dsts := []string{filepath.Join(dst, "a"), filepath.Join(dst, "renamed"), filepath.Join(dst, "c")}
+		_, errs := waitProgress(copyEntries(srcs, dsts, nil, nil))
+		for _, err := range errs {
+			t.Errorf("at format '%s' copying: %s", ext, err)
+		}
+
+		files := map[string]string{"a": "foo", filepath.Join("renamed", "b"): "bar", "c": "baz"}
+		for name, data := range files {
+			b, err := os.ReadFile(filepath.Join(dst, name))
+			if err != nil || string(b) != data {
+				t.Errorf("at format '%s' expected file '%s' to have '%s' but got '%s' with error '%v'", ext, name, data, b, err)
+			}
+		}
+
+		if _, err := os.Lstat(filepath.Join(dst, "dir")); !os.IsNotExist(err) {
+			t.Errorf("at format '%s' directory should be extracted with the new name", ext)
+		}
+	}
+}
+
+func TestPlanPasteEntries(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := filepath.Join(tmp, "archive.zip")
+	writeTestArchive(t, path)
+
+	items, _, err := planPaste([]string{filepath.Join(path, "a"), filepath.Join(path, "dir")}, true, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for _, item := range items {
+		got[item.path] = item.status
+	}
+	for _, name := range []string{"a", "dir", filepath.Join("dir", "b")} {
+		if status := got[filepath.Join(tmp, name)]; status != "new" {
+			t.Errorf("at file '%s' expected status 'new' but got '%s'", name, status)
+		}
+	}
+}
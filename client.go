@@ -17,9 +17,10 @@ import (
 
 func run() {
 	var screen tcell.Screen
+	var tty io.Writer
 	var err error
 
-	if screen, err = tcell.NewScreen(); err != nil {
+	if screen, tty, err = newScreen(); err != nil {
 		golog.Fatal("creating screen: %s", err)
 	} else if err = screen.Init(); err != nil {
 		golog.Fatal("initializing screen: %s", err)
@@ -42,6 +43,7 @@ func run() {
 	golog.Info("hi!")
 
 	ui := newUI(screen)
+	ui.tty = tty
 	nav := newNav(ui.wins[0].h)
 	app := newApp(ui, nav)
 
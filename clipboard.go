@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// osc52 returns the escape sequence setting the clipboard of the terminal to
+// the given text, which is supported by many terminals even over SSH.
+func osc52(text string) string {
+	return "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+}
+
+// setClipboard puts the given text on the system clipboard using the command in
+// 'clipboardcopy' option, or the OSC 52 escape sequence if it is empty.
+func (app *app) setClipboard(text string) error {
+	if genOpts.clipboardcopy != "" {
+		cmd := shellCommand(genOpts.clipboardcopy, nil)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running clipboard command: %s", err)
+		}
+		return nil
+	}
+
+	if app.ui.tty == nil {
+		return errors.New("terminal is not available, set 'clipboardcopy' option instead")
+	}
+
+	if _, err := io.WriteString(app.ui.tty, osc52(text)); err != nil {
+		return fmt.Errorf("writing to terminal: %s", err)
+	}
+
+	return nil
+}
+
+// getClipboard returns the text on the system clipboard using the command in
+// 'clipboardpaste' option. Terminals usually do not allow reading the
+// clipboard with escape sequences, so the option is required.
+func getClipboard() (string, error) {
+	if genOpts.clipboardpaste == "" {
+		return "", errors.New("'clipboardpaste' option is not set")
+	}
+
+	out, err := shellCommand(genOpts.clipboardpaste, nil).Output()
+	if err != nil {
+		return "", fmt.Errorf("running clipboard command: %s", err)
+	}
+
+	return string(out), nil
+}
+
+// yankText returns the text put on the clipboard by the yank command of the
+// given kind, which is one path, name or directory per line for the current
+// file or the selections. Directories are only listed once.
+func (nav *nav) yankText(kind string) (string, error) {
+	list, err := nav.currFileOrSelections()
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	seen := make(map[string]bool)
+	for _, path := range list {
+		switch kind {
+		case "name":
+			path = filepath.Base(path)
+		case "dir":
+			path = filepath.Dir(path)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+		}
+		lines = append(lines, path)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// clipboardPaths returns the paths in the given newline separated text. Empty
+// lines are skipped, 'file://' URIs used by graphical file managers are
+// converted to paths, and relative paths are relative to the given directory.
+func clipboardPaths(text, dir string) []string {
+	var paths []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "file://") {
+			if u, err := url.Parse(line); err == nil {
+				line = u.Path
+			}
+		}
+
+		line = replaceTilde(line)
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+
+		paths = append(paths, filepath.Clean(line))
+	}
+	return paths
+}
+
+// pasteFromClipboard saves the paths on the system clipboard to the given
+// register to be copied. Paths of files that do not exist are reported as an
+// error after the others are saved. It returns the number of saved paths.
+func (nav *nav) pasteFromClipboard(reg string) (int, error) {
+	text, err := getClipboard()
+	if err != nil {
+		return 0, err
+	}
+
+	var list, missing []string
+	for _, path := range clipboardPaths(text, nav.currDir().path) {
+		if _, err := os.Lstat(path); err != nil {
+			missing = append(missing, path)
+			continue
+		}
+		list = append(list, path)
+	}
+
+	if len(list) == 0 && len(missing) == 0 {
+		return 0, errors.New("no paths on clipboard")
+	}
+
+	if len(list) > 0 {
+		if err := saveFiles(reg, list, true); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(missing) > 0 {
+		return len(list), fmt.Errorf("no such files: %s", strings.Join(missing, " "))
+	}
+
+	return len(list), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOSC52(t *testing.T) {
+	if got, exp := osc52("foo"), "\033]52;c;Zm9v\a"; got != exp {
+		t.Errorf("expected '%q' but got '%q'", exp, got)
+	}
+}
+
+func TestClipboardPaths(t *testing.T) {
+	dir := filepath.FromSlash("/dir")
+
+	tests := []struct {
+		text string
+		exp  []string
+	}{
+		{"", nil},
+		{"/foo/bar\n", []string{filepath.FromSlash("/foo/bar")}},
+		{"a\r\n\n  b/../c  \n", []string{filepath.Join(dir, "a"), filepath.Join(dir, "c")}},
+		{"file:///foo/with%20space", []string{filepath.FromSlash("/foo/with space")}},
+	}
+
+	for _, test := range tests {
+		if got := clipboardPaths(test.text, dir); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("at input '%q' expected '%v' but got '%v'", test.text, test.exp, got)
+		}
+	}
+}
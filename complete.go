@@ -39,11 +39,26 @@ var (
 		"unselect",
 		"glob-select",
 		"glob-unselect",
+		"selection-save",
+		"selection-load",
+		"selection-list",
 		"calcdirsize",
 		"copy",
 		"cut",
+		"copy-append",
+		"cut-append",
 		"paste",
+		"paste-preview",
+		"paste-symlink",
+		"paste-relative-symlink",
+		"paste-hardlink",
 		"clear",
+		"register",
+		"registers",
+		"yank-path",
+		"yank-name",
+		"yank-dir",
+		"paste-from-clipboard",
 		"sync",
 		"draw",
 		"redraw",
@@ -55,7 +70,29 @@ var (
 		"cd",
 		"select",
 		"delete",
+		"trash",
+		"trash-restore",
+		"trash-empty",
+		"undo",
+		"redo",
+		"jobs",
+		"job-cancel",
+		"job-pause",
 		"rename",
+		"bulk-rename",
+		"rename-pattern",
+		"mkdir",
+		"mkdir-cd",
+		"touch",
+		"archive",
+		"extract",
+		"find-duplicates",
+		"flatten",
+		"du",
+		"du-exit",
+		"chmod",
+		"chown",
+		"chmod-edit",
 		"source",
 		"push",
 		"read",
@@ -111,11 +148,17 @@ var (
 		"anchorfind",
 		"noanchorfind",
 		"anchorfind!",
+		"archivedirs",
+		"noarchivedirs",
+		"archivedirs!",
 		"autoquit",
 		"noautoquit",
 		"autoquit!",
 		"cursorfmt",
 		"cursorpreviewfmt",
+		"autodirsize",
+		"noautodirsize",
+		"autodirsize!",
 		"dircache",
 		"nodircache",
 		"dircache!",
@@ -164,6 +207,9 @@ var (
 		"preview",
 		"nopreview",
 		"preview!",
+		"progressbar",
+		"noprogressbar",
+		"progressbar!",
 		"relativenumber",
 		"norelativenumber",
 		"relativenumber!",
@@ -176,13 +222,20 @@ var (
 		"smartdia",
 		"nosmartdia",
 		"smartdia!",
+		"verifycopy",
+		"noverifycopy",
+		"verifycopy!",
 		"waitmsg",
+		"watch",
+		"nowatch",
+		"watch!",
 		"wrapscan",
 		"nowrapscan",
 		"wrapscan!",
 		"wrapscroll",
 		"nowrapscroll",
 		"wrapscroll!",
+		"copyworkers",
 		"findlen",
 		"period",
 		"scrolloff",
@@ -193,8 +246,13 @@ var (
 		"history",
 		"ifs",
 		"info",
+		"preserve",
 		"previewer",
 		"cleaner",
+		"clipboardcopy",
+		"clipboardpaste",
+		"deletemode",
+		"pasteconflict",
 		"promptfmt",
 		"ratios",
 		"selmode",
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
 func copySize(srcs []string) (int64, error) {
@@ -32,9 +37,117 @@ func copySize(srcs []string) (int64, error) {
 	return total, nil
 }
 
-func copyFile(src, dst string, info os.FileInfo, nums chan int64) error {
-	buf := make([]byte, 4096)
+const (
+	copyChunkSize        = 8 << 20 // bytes copied at once by kernel copy functions
+	copyBufferSize       = 1 << 20 // buffer size for regular copying
+	copySmallSize        = 1 << 20 // files smaller than this are copied by workers
+	copyProgressInterval = 100 * time.Millisecond
+)
+
+var errCopyUnsupported = errors.New("copy method not supported")
+
+// copyProgress accumulates copied bytes and sends them to the progress channel
+// in intervals to avoid sending a message for each copied chunk. Methods of
+// copyProgress can be called on a nil progress, which does not report anything.
+type copyProgress struct {
+	mutex sync.Mutex
+	nums  chan int64
+	n     int64
+	last  time.Time
+}
+
+func newCopyProgress(nums chan int64) *copyProgress {
+	return &copyProgress{nums: nums, last: time.Now()}
+}
+
+func (p *copyProgress) add(n int64) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.n += n
+	if now := time.Now(); now.Sub(p.last) >= copyProgressInterval {
+		p.nums <- p.n
+		p.n = 0
+		p.last = now
+	}
+}
+
+func (p *copyProgress) flush() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
+	if p.n != 0 {
+		p.nums <- p.n
+		p.n = 0
+	}
+}
+
+// copyData copies the contents of r to w. Cloning the file with a reflink is
+// tried first, then sparse files are copied without their holes, then kernel
+// copy functions are used in chunks, and finally the contents are copied
+// through a buffer when none of them is supported.
+func copyData(w, r *os.File, size int64, p *copyProgress, j *job) error {
+	if size > 0 && cloneFile(w, r) == nil {
+		p.add(size)
+		return nil
+	}
+
+	if err := copySparse(w, r, size, p, j); err != errCopyUnsupported {
+		return err
+	}
+
+	for {
+		if err := j.check(); err != nil {
+			return err
+		}
+
+		n, err := kernelCopy(w, r, copyChunkSize)
+		if err != nil && err != errCopyUnsupported {
+			return err
+		}
+		if n == 0 {
+			// copying through a buffer also handles files reported with a
+			// wrong size such as the ones in procfs
+			return copyBuffer(w, r, p, j)
+		}
+		p.add(int64(n))
+	}
+}
+
+// copyBuffer copies the contents of r to w through a large buffer until EOF.
+func copyBuffer(w io.Writer, r io.Reader, p *copyProgress, j *job) error {
+	buf := make([]byte, copyBufferSize)
+
+	for {
+		if err := j.check(); err != nil {
+			return err
+		}
+
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			p.add(int64(n))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func copyFile(src, dst string, info os.FileInfo, p *copyProgress, j *job) error {
 	r, err := os.Open(src)
 	if err != nil {
 		return err
@@ -46,52 +159,295 @@ func copyFile(src, dst string, info os.FileInfo, nums chan int64) error {
 		return err
 	}
 
-	for {
-		n, err := r.Read(buf)
-		if err != nil && err != io.EOF {
-			w.Close()
-			os.Remove(dst)
+	// partially written file is also removed when the job is cancelled
+	if err := copyData(w, r, info.Size(), p, j); err != nil {
+		w.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return nil
+}
+
+// fileChecksum returns the SHA-256 checksum of the contents of the given file.
+// When sync is true, the file is synced and dropped from the page cache first
+// so that its contents are read back from the device where possible.
+func fileChecksum(path string, sync bool) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if sync {
+		if err := f.Sync(); err != nil {
+			return nil, err
+		}
+		dropCache(f)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// verifyFile returns an error if the contents of the given files differ.
+func verifyFile(src, dst string) error {
+	srcSum, err := fileChecksum(src, false)
+	if err != nil {
+		return err
+	}
+
+	dstSum, err := fileChecksum(dst, true)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(srcSum, dstSum) {
+		return fmt.Errorf("%s: checksum mismatch with %s", dst, src)
+	}
+
+	return nil
+}
+
+// numberedPath returns the given path if it does not exist, otherwise a suffix
+// that is compatible with '--backup=numbered' option in GNU cp is added.
+func numberedPath(path string) string {
+	_, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return path
+	}
+
+	var newPath string
+	for i := 1; !os.IsNotExist(err); i++ {
+		newPath = fmt.Sprintf("%s.~%d~", path, i)
+		_, err = os.Lstat(newPath)
+	}
+
+	return newPath
+}
+
+// sameFile reports whether the given paths exist and refer to the same file,
+// such as when a file is pasted into its own directory.
+func sameFile(src, dst string) bool {
+	srcStat, err := os.Lstat(src)
+	if err != nil {
+		return false
+	}
+
+	dstStat, err := os.Lstat(dst)
+	return err == nil && os.SameFile(srcStat, dstStat)
+}
+
+// copyDest returns the destination path of copying the given source into the
+// given directory. Copies into the source directory are always renamed since
+// replacing the destination would remove the source.
+func copyDest(src, dstDir string) string {
+	dst := filepath.Join(dstDir, filepath.Base(src))
+	if genOpts.pasteconflict == "rename" || sameFile(src, dst) {
+		return numberedPath(dst)
+	}
+	return dst
+}
+
+// relativeLink returns the target of a relative symbolic link to the given
+// source created in the given directory. Both directories are resolved first
+// since the target is interpreted relative to the real directory of the link.
+// The source file itself is not resolved so that links to symbolic links are
+// kept as is.
+func relativeLink(src, dir string) (string, error) {
+	srcDir, err := filepath.EvalSymlinks(filepath.Dir(src))
+	if err != nil {
+		return "", err
+	}
+
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Rel(dir, filepath.Join(srcDir, filepath.Base(src)))
+}
+
+// linkFile creates a link of the given kind pointing to the given source at
+// the given destination. Kind is one of 'symlink', 'relative-symlink' or
+// 'hardlink'.
+func linkFile(kind, src, dst string) error {
+	switch kind {
+	case "symlink":
+		return os.Symlink(src, dst)
+	case "relative-symlink":
+		target, err := relativeLink(src, filepath.Dir(dst))
+		if err != nil {
 			return err
 		}
+		return os.Symlink(target, dst)
+	case "hardlink":
+		return os.Link(src, dst)
+	}
 
-		if n == 0 {
-			break
+	return fmt.Errorf("unknown link kind: %s", kind)
+}
+
+// restoreDirMode removes the owner permissions added to the given copied
+// directory to write its contents, so that it has the mode it was created with
+// otherwise.
+func restoreDirMode(dst string, info os.FileInfo) error {
+	added := 0o700 &^ info.Mode().Perm()
+	if added == 0 {
+		return nil
+	}
+
+	stat, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(dst, stat.Mode()&^added)
+}
+
+// preserveAttrs applies the given attributes of the source file to the
+// destination file. Owner is changed first since it may clear setuid and setgid
+// bits, and timestamps are changed last since other changes may update them.
+func preserveAttrs(src, dst string, info os.FileInfo, preserve []string) error {
+	has := func(attr string) bool {
+		for _, s := range preserve {
+			if s == attr {
+				return true
+			}
+		}
+		return false
+	}
+
+	if has("owner") {
+		if err := preserveOwner(dst, info); err != nil {
+			return err
 		}
+	}
 
-		if _, err := w.Write(buf[:n]); err != nil {
+	if has("xattr") {
+		if err := preserveXattr(src, dst); err != nil {
 			return err
 		}
+	}
 
-		nums <- int64(n)
+	if has("mode") && info.Mode()&os.ModeSymlink == 0 {
+		if err := os.Chmod(dst, info.Mode()); err != nil {
+			return err
+		}
 	}
 
-	if err := w.Close(); err != nil {
-		os.Remove(dst)
-		return err
+	if has("timestamps") {
+		if err := preserveTimes(dst, info); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func copyAll(srcs []string, dstDir string) (nums chan int64, errs chan error) {
+// conflictFunc is called when a file already exists at the destination of a
+// copy or move operation, and it returns true if the existing file should be
+// replaced. Existing directories are merged without calling it.
+type conflictFunc func(src os.FileInfo, dst string) bool
+
+// copyAll copies the given sources to the given destinations. When the
+// 'copyworkers' option is more than one, small files are copied in parallel by
+// that many workers.
+func copyAll(srcs, dsts []string, replace conflictFunc, j *job) (nums chan int64, errs chan error) {
 	nums = make(chan int64, 1024)
 	errs = make(chan error, 1024)
 
-	go func() {
-		for _, src := range srcs {
-			dst := filepath.Join(dstDir, filepath.Base(src))
-
-			_, err := os.Lstat(dst)
-			if !os.IsNotExist(err) {
-				var newPath string
-				for i := 1; !os.IsNotExist(err); i++ {
-					newPath = fmt.Sprintf("%s.~%d~", dst, i)
-					_, err = os.Lstat(newPath)
+	preserve := genOpts.preserve
+	workers := genOpts.copyworkers
+	verify := genOpts.verifycopy
+
+	type copyTask struct {
+		src, dst string
+		info     os.FileInfo
+	}
+
+	p := newCopyProgress(nums)
+
+	// skipped directories are counted with their contents so that the
+	// progress still reaches the total
+	skip := func(path string, info os.FileInfo) error {
+		if info.IsDir() {
+			n, _ := copySize([]string{path})
+			p.add(n)
+			return filepath.SkipDir
+		}
+		p.add(info.Size())
+		return nil
+	}
+
+	copyTo := func(t copyTask) bool {
+		if err := copyFile(t.src, t.dst, t.info, p, j); err == errJobCancelled {
+			return false
+		} else if err != nil {
+			errs <- fmt.Errorf("copy: %s", err)
+			return true
+		}
+		if verify {
+			if err := verifyFile(t.src, t.dst); err != nil {
+				os.Remove(t.dst)
+				errs <- fmt.Errorf("verify: %s", err)
+				return true
+			}
+		}
+		if err := preserveAttrs(t.src, t.dst, t.info, preserve); err != nil {
+			errs <- fmt.Errorf("preserve: %s", err)
+		}
+		return true
+	}
+
+	type dirTask struct {
+		copyTask
+		created bool
+	}
+
+	var tasks chan copyTask
+	var wg, workerWg sync.WaitGroup
+
+	if workers > 1 {
+		tasks = make(chan copyTask, workers)
+		for i := 0; i < workers; i++ {
+			workerWg.Add(1)
+			go func() {
+				defer workerWg.Done()
+				for t := range tasks {
+					if j.check() == nil {
+						copyTo(t)
+					}
+					wg.Done()
 				}
-				dst = newPath
+			}()
+		}
+	}
+
+	go func() {
+		for i, src := range srcs {
+			if j.isCancelled() {
+				break
 			}
 
+			dst := dsts[i]
+
+			// attributes of directories are applied after their contents
+			var dirs []dirTask
+
 			filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+				if err := j.check(); err != nil {
+					return filepath.SkipAll
+				}
 				if err != nil {
 					errs <- fmt.Errorf("walk: %s", err)
 					return nil
@@ -102,31 +458,188 @@ func copyAll(srcs []string, dstDir string) (nums chan int64, errs chan error) {
 					return nil
 				}
 				newPath := filepath.Join(dst, rel)
+				j.setFile(path)
+				if dstInfo, err := os.Lstat(newPath); err == nil && os.SameFile(info, dstInfo) {
+					// replacing the destination would remove the source
+					errs <- fmt.Errorf("copy: source and destination are the same file: %s", path)
+					return skip(path, info)
+				} else if err == nil && !(info.IsDir() && dstInfo.IsDir()) {
+					if replace == nil || !replace(info, newPath) {
+						return skip(path, info)
+					}
+					if err := os.RemoveAll(newPath); err != nil {
+						errs <- fmt.Errorf("remove: %s", err)
+						return nil
+					}
+				}
 				if info.IsDir() {
-					if err := os.MkdirAll(newPath, info.Mode()); err != nil {
+					_, err := os.Lstat(newPath)
+					created := os.IsNotExist(err)
+					// owner permissions are needed to write the contents
+					if err := os.MkdirAll(newPath, info.Mode()|0o700); err != nil {
 						errs <- fmt.Errorf("mkdir: %s", err)
+					} else {
+						dirs = append(dirs, dirTask{copyTask{path, newPath, info}, created})
 					}
-					nums <- info.Size()
+					p.add(info.Size())
+					return nil
 				} else if info.Mode()&os.ModeSymlink != 0 { /* Symlink */
-					if rlink, err := os.Readlink(path); err != nil {
+					p.add(info.Size())
+					rlink, err := os.Readlink(path)
+					if err != nil {
 						errs <- fmt.Errorf("symlink: %s", err)
-					} else {
-						if err := os.Symlink(rlink, newPath); err != nil {
-							errs <- fmt.Errorf("symlink: %s", err)
-						}
+						return nil
 					}
-					nums <- info.Size()
-				} else {
-					if err := copyFile(path, newPath, info, nums); err != nil {
+					if err := os.Symlink(rlink, newPath); err != nil {
+						errs <- fmt.Errorf("symlink: %s", err)
+						return nil
+					}
+					if err := preserveAttrs(path, newPath, info, preserve); err != nil {
+						errs <- fmt.Errorf("preserve: %s", err)
+					}
+				} else if info.Mode()&os.ModeSocket != 0 {
+					// sockets are created by the programs listening on them
+					p.add(info.Size())
+					errs <- fmt.Errorf("copy: skipping socket %s", path)
+				} else if info.Mode()&(os.ModeNamedPipe|os.ModeDevice) != 0 {
+					// opening pipes blocks and reading devices copies their contents
+					p.add(info.Size())
+					if err := makeSpecial(newPath, info); err != nil {
 						errs <- fmt.Errorf("copy: %s", err)
+						return nil
+					}
+					if err := preserveAttrs(path, newPath, info, preserve); err != nil {
+						errs <- fmt.Errorf("preserve: %s", err)
 					}
+				} else if tasks != nil && info.Size() < copySmallSize {
+					wg.Add(1)
+					tasks <- copyTask{path, newPath, info}
+				} else if !copyTo(copyTask{path, newPath, info}) {
+					return filepath.SkipAll
 				}
 				return nil
 			})
+
+			wg.Wait()
+
+			for i := len(dirs) - 1; i >= 0; i-- {
+				d := dirs[i]
+				if d.created {
+					if err := restoreDirMode(d.dst, d.info); err != nil {
+						errs <- fmt.Errorf("chmod: %s", err)
+					}
+				}
+				if err := preserveAttrs(d.src, d.dst, d.info, preserve); err != nil {
+					errs <- fmt.Errorf("preserve: %s", err)
+				}
+			}
 		}
 
+		if tasks != nil {
+			close(tasks)
+			workerWg.Wait()
+		}
+
+		p.flush()
 		close(errs)
 	}()
 
 	return nums, errs
 }
+
+// pasteItem is a file that would be created or changed by a paste operation.
+type pasteItem struct {
+	path   string // destination path
+	size   int64
+	status string // new, rename, merge, overwrite, skip, ask or same
+	cross  bool   // moved across devices by copying and then deleting
+}
+
+// pasteStatus returns how an existing destination file is handled according to
+// the 'pasteconflict' option, which is the same as the decision of the
+// function returned by 'conflictFunc' except for asking the user.
+func pasteStatus(src, dst os.FileInfo) string {
+	switch genOpts.pasteconflict {
+	case "overwrite", "ask":
+		return genOpts.pasteconflict
+	case "newer":
+		if src.ModTime().After(dst.ModTime()) {
+			return "overwrite"
+		}
+	}
+	return "skip"
+}
+
+// planPaste walks the given sources without changing anything and returns
+// every destination path of pasting them into the given directory along with
+// the total size of files that would be copied or moved.
+func planPaste(srcs []string, cp bool, dstDir string) ([]*pasteItem, int64, error) {
+	dirStat, err := os.Stat(dstDir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var items []*pasteItem
+	var total int64
+
+	for _, src := range srcs {
+		srcStat, err := archiveLstat(src)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		dst := filepath.Join(dstDir, filepath.Base(src))
+		cross := !cp && fileDevice(srcStat) != fileDevice(dirStat)
+
+		renamed := false
+		if dstStat, err := os.Lstat(dst); err == nil {
+			// copies into the source directory are renamed as in 'copyDest'
+			same := os.SameFile(srcStat, dstStat)
+			if same && !cp {
+				items = append(items, &pasteItem{dst, srcStat.Size(), "same", false})
+				continue
+			}
+			if genOpts.pasteconflict == "rename" || same {
+				dst = numberedPath(dst)
+				renamed = true
+			}
+		}
+
+		err = walkEntries(src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf("walk: %s", err)
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return fmt.Errorf("relative: %s", err)
+			}
+
+			item := &pasteItem{filepath.Join(dst, rel), info.Size(), "new", cross}
+			if renamed && path == src {
+				item.status = "rename"
+			} else if dstInfo, err := os.Lstat(item.path); err == nil {
+				if info.IsDir() && dstInfo.IsDir() {
+					item.status = "merge"
+				} else {
+					item.status = pasteStatus(info, dstInfo)
+				}
+			}
+			items = append(items, item)
+
+			if item.status == "skip" {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			total += info.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return items, total, nil
+}
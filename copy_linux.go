@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// preserveXattr copies extended attributes of the source file to the
+// destination file. Attributes that are not supported or not permitted at the
+// destination are skipped.
+func preserveXattr(src, dst string) error {
+	size, err := unix.Llistxattr(src, nil)
+	if err == unix.ENOTSUP {
+		return nil
+	}
+	if err != nil {
+		return &os.PathError{Op: "listxattr", Path: src, Err: err}
+	}
+	if size == 0 {
+		return nil
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(src, buf)
+	if err != nil {
+		return &os.PathError{Op: "listxattr", Path: src, Err: err}
+	}
+
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+
+		size, err := unix.Lgetxattr(src, attr, nil)
+		if err != nil {
+			return &os.PathError{Op: "getxattr", Path: src, Err: err}
+		}
+		val := make([]byte, size)
+		size, err = unix.Lgetxattr(src, attr, val)
+		if err != nil {
+			return &os.PathError{Op: "getxattr", Path: src, Err: err}
+		}
+
+		if err := unix.Lsetxattr(dst, attr, val[:size], 0); err != nil {
+			if err == unix.ENOTSUP || err == unix.EPERM || err == unix.EACCES {
+				continue
+			}
+			return &os.PathError{Op: "setxattr", Path: dst, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// cloneFile shares the data blocks of the source file with the destination
+// file on filesystems supporting reflinks such as btrfs and xfs.
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// makeSpecial creates a named pipe or a device node at the given path with the
+// type, permissions and device number of the given file.
+func makeSpecial(path string, f os.FileInfo) error {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return &os.PathError{Op: "mknod", Path: path, Err: unix.ENOTSUP}
+	}
+
+	mode := uint32(f.Mode().Perm())
+	switch {
+	case f.Mode()&os.ModeNamedPipe != 0:
+		if err := unix.Mkfifo(path, mode); err != nil {
+			return &os.PathError{Op: "mkfifo", Path: path, Err: err}
+		}
+		return nil
+	case f.Mode()&os.ModeCharDevice != 0:
+		mode |= unix.S_IFCHR
+	default:
+		mode |= unix.S_IFBLK
+	}
+
+	if err := unix.Mknod(path, mode, int(stat.Rdev)); err != nil {
+		return &os.PathError{Op: "mknod", Path: path, Err: err}
+	}
+	return nil
+}
+
+// copySparse copies the data regions of a sparse file found with SEEK_DATA and
+// SEEK_HOLE, so that holes are left unallocated in the destination file. It
+// returns errCopyUnsupported before writing anything if the source file is not
+// sparse or the filesystem cannot report its holes.
+func copySparse(w, r *os.File, size int64, p *copyProgress, j *job) error {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(r.Fd()), &stat); err != nil || stat.Blocks*512 >= size {
+		return errCopyUnsupported
+	}
+
+	var off int64
+	for off < size {
+		if err := j.check(); err != nil {
+			return err
+		}
+
+		data, err := unix.Seek(int(r.Fd()), off, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			// the rest of the file is a hole
+			break
+		}
+		if err != nil {
+			if off == 0 {
+				return errCopyUnsupported
+			}
+			return &os.PathError{Op: "seek", Path: r.Name(), Err: err}
+		}
+
+		hole, err := unix.Seek(int(r.Fd()), data, unix.SEEK_HOLE)
+		if err != nil {
+			return &os.PathError{Op: "seek", Path: r.Name(), Err: err}
+		}
+
+		p.add(data - off)
+		if err := copyBuffer(io.NewOffsetWriter(w, data), io.NewSectionReader(r, data, hole-data), p, j); err != nil {
+			return err
+		}
+		off = hole
+	}
+
+	p.add(size - off)
+	return w.Truncate(size)
+}
+
+// kernelCopy copies at most n bytes from the source file to the destination
+// file without passing the data through user space. It returns zero when the
+// end of the source file is reached.
+func kernelCopy(dst, src *os.File, n int) (int, error) {
+	written, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, n, 0)
+	if err == nil {
+		return written, nil
+	}
+
+	switch err {
+	case unix.EXDEV, unix.ENOSYS, unix.EINVAL, unix.EOPNOTSUPP, unix.EBADF, unix.EPERM:
+		written, err = unix.Sendfile(int(dst.Fd()), int(src.Fd()), nil, n)
+		if err == nil {
+			return written, nil
+		}
+		if err == unix.EINVAL || err == unix.ENOSYS {
+			return 0, errCopyUnsupported
+		}
+	}
+
+	return 0, err
+}
+
+// dropCache removes the cached pages of the given file so that its contents are
+// read from the device. Errors are ignored since this is only advisory.
+func dropCache(f *os.File) {
+	unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCopyAllSpecial(t *testing.T) {
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	if err := os.Mkdir(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mkfifo(filepath.Join(src, "fifo"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", filepath.Join(src, "socket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	f, err := os.Create(filepath.Join(src, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("foo"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(3 << 20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var errMsgs []string
+	_, errs := waitProgress(copyAll([]string{src}, []string{dst}, nil, nil))
+	for _, err := range errs {
+		errMsgs = append(errMsgs, err.Error())
+	}
+
+	if len(errMsgs) != 1 || !strings.Contains(errMsgs[0], "skipping socket") {
+		t.Errorf("expected a single error for the socket but got '%v'", errMsgs)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "socket")); !os.IsNotExist(err) {
+		t.Errorf("socket should not be copied")
+	}
+
+	info, err := os.Lstat(filepath.Join(dst, "fifo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 || info.Mode().Perm() != 0o640 {
+		t.Errorf("expected named pipe with mode '%v' but got '%v'", os.FileMode(0o640), info.Mode())
+	}
+
+	b, err := os.ReadFile(filepath.Join(dst, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := make([]byte, 3<<20)
+	copy(exp[1<<20:], "foo")
+	if !bytes.Equal(b, exp) {
+		t.Errorf("contents of sparse file are not copied correctly")
+	}
+
+	srcInfo, err := os.Lstat(filepath.Join(src, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Lstat(filepath.Join(dst, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcBlocks := srcInfo.Sys().(*syscall.Stat_t).Blocks
+	dstBlocks := dstInfo.Sys().(*syscall.Stat_t).Blocks
+	if srcBlocks*512 < srcInfo.Size() && dstBlocks*512 >= dstInfo.Size() {
+		t.Errorf("expected sparse copy but got '%d' blocks for '%d' bytes", dstBlocks, dstInfo.Size())
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+func preserveXattr(src, dst string) error {
+	return nil
+}
+
+func cloneFile(dst, src *os.File) error {
+	return errCopyUnsupported
+}
+
+func makeSpecial(path string, f os.FileInfo) error {
+	return &os.PathError{Op: "mknod", Path: path, Err: errCopyUnsupported}
+}
+
+func copySparse(w, r *os.File, size int64, p *copyProgress, j *job) error {
+	return errCopyUnsupported
+}
+
+func kernelCopy(dst, src *os.File, n int) (int, error) {
+	return 0, errCopyUnsupported
+}
+
+func dropCache(f *os.File) {}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitProgress reads the given progress channels until the error channel is
+// closed, and returns the number of processed bytes and the errors.
+func waitProgress(nums chan int64, errs chan error) (int64, []error) {
+	var n int64
+	var got []error
+	for {
+		select {
+		case x := <-nums:
+			n += x
+		case err, ok := <-errs:
+			if !ok {
+				// progress sent right before closing the error channel may remain
+				for len(nums) > 0 {
+					n += <-nums
+				}
+				return n, got
+			}
+			got = append(got, err)
+		}
+	}
+}
+
+func TestCopyAllConflict(t *testing.T) {
+	tests := []struct {
+		replace conflictFunc
+		exp     string
+	}{
+		{nil, "old"},
+		{func(src os.FileInfo, dst string) bool { return false }, "old"},
+		{func(src os.FileInfo, dst string) bool { return true }, "new"},
+	}
+
+	for _, test := range tests {
+		tmp := t.TempDir()
+
+		src := filepath.Join(tmp, "src", "dir")
+		dst := filepath.Join(tmp, "dst", "dir")
+		for _, dir := range []string{src, dst} {
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		files := []struct {
+			path string
+			data string
+		}{
+			{filepath.Join(src, "a"), "new"},
+			{filepath.Join(src, "b"), "new"},
+			{filepath.Join(dst, "a"), "old"},
+			{filepath.Join(dst, "c"), "old"},
+		}
+		for _, f := range files {
+			if err := os.WriteFile(f.path, []byte(f.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, errs := waitProgress(copyAll([]string{src}, []string{dst}, test.replace, nil))
+		for _, err := range errs {
+			t.Errorf("copying: %s", err)
+		}
+
+		exps := []struct {
+			name string
+			data string
+		}{
+			{"a", test.exp},
+			{"b", "new"},
+			{"c", "old"},
+		}
+		for _, e := range exps {
+			b, err := os.ReadFile(filepath.Join(dst, e.name))
+			if err != nil {
+				t.Errorf("reading '%s': %s", e.name, err)
+				continue
+			}
+			if string(b) != e.data {
+				t.Errorf("at file '%s' expected '%s' but got '%s'", e.name, e.data, b)
+			}
+		}
+	}
+}
+
+func TestCopyAllPreserve(t *testing.T) {
+	defer func(preserve []string) { genOpts.preserve = preserve }(genOpts.preserve)
+	genOpts.preserve = []string{"mode", "timestamps"}
+
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	file := filepath.Join(src, "file")
+
+	if err := os.Mkdir(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("foo"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.Local)
+	for _, path := range []string{file, src} {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(src, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(src, 0o755)
+
+	_, errs := waitProgress(copyAll([]string{src}, []string{dst}, nil, nil))
+	for _, err := range errs {
+		t.Errorf("copying: %s", err)
+	}
+	defer os.Chmod(dst, 0o755)
+
+	tests := []struct {
+		path string
+		mode os.FileMode
+	}{
+		{dst, 0o555},
+		{filepath.Join(dst, "file"), 0o640},
+	}
+
+	for _, test := range tests {
+		info, err := os.Lstat(test.path)
+		if err != nil {
+			t.Errorf("stat '%s': %s", test.path, err)
+			continue
+		}
+		if info.Mode().Perm() != test.mode {
+			t.Errorf("at file '%s' expected mode '%v' but got '%v'", test.path, test.mode, info.Mode().Perm())
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("at file '%s' expected modification time '%v' but got '%v'", test.path, mtime, info.ModTime())
+		}
+	}
+}
+
+func TestCopyAllDirMode(t *testing.T) {
+	defer func(preserve []string) { genOpts.preserve = preserve }(genOpts.preserve)
+	genOpts.preserve = nil
+
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	if err := os.Mkdir(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "file"), []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(src, 0o755)
+
+	_, errs := waitProgress(copyAll([]string{src}, []string{dst}, nil, nil))
+	for _, err := range errs {
+		t.Errorf("copying: %s", err)
+	}
+	defer os.Chmod(dst, 0o755)
+
+	info, err := os.Lstat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o555 {
+		t.Errorf("expected mode '%v' but got '%v'", os.FileMode(0o555), info.Mode().Perm())
+	}
+}
+
+func TestCopyFileCancel(t *testing.T) {
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	if err := os.WriteFile(src, []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := newJobList().add("copy", tmp)
+	j.cancel()
+
+	if err := copyFile(src, dst, info, newCopyProgress(make(chan int64, 1)), j); err != errJobCancelled {
+		t.Errorf("expected error '%s' but got '%v'", errJobCancelled, err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("partially written file '%s' should be removed", dst)
+	}
+}
+
+func TestCopyAllWorkers(t *testing.T) {
+	defer func(workers int) { genOpts.copyworkers = workers }(genOpts.copyworkers)
+	genOpts.copyworkers = 4
+
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	if err := os.MkdirAll(filepath.Join(src, "dir"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"a", "b", "c", filepath.Join("dir", "d"), filepath.Join("dir", "e")}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total, err := copySize([]string{src})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, errs := waitProgress(copyAll([]string{src}, []string{dst}, nil, nil))
+	for _, err := range errs {
+		t.Errorf("copying: %s", err)
+	}
+
+	if copied != total {
+		t.Errorf("expected '%d' copied bytes but got '%d'", total, copied)
+	}
+
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Errorf("reading '%s': %s", name, err)
+			continue
+		}
+		if string(b) != name {
+			t.Errorf("at file '%s' expected '%s' but got '%s'", name, name, b)
+		}
+	}
+}
+
+func TestPlanPaste(t *testing.T) {
+	defer func(conflict string) { genOpts.pasteconflict = conflict }(genOpts.pasteconflict)
+
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "src", "dir")
+	dst := filepath.Join(tmp, "dst")
+	for _, dir := range []string{src, filepath.Join(dst, "dir")} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(src, "a"), filepath.Join(src, "b"), filepath.Join(dst, "dir", "a")} {
+		if err := os.WriteFile(path, []byte("foo"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		conflict string
+		exp      map[string]string
+	}{
+		{"rename", map[string]string{"dir.~1~": "rename", "dir.~1~/a": "new", "dir.~1~/b": "new"}},
+		{"overwrite", map[string]string{"dir": "merge", "dir/a": "overwrite", "dir/b": "new"}},
+		{"skip", map[string]string{"dir": "merge", "dir/a": "skip", "dir/b": "new"}},
+	}
+
+	for _, test := range tests {
+		genOpts.pasteconflict = test.conflict
+
+		items, _, err := planPaste([]string{src}, true, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make(map[string]string)
+		for _, item := range items {
+			rel, _ := filepath.Rel(dst, item.path)
+			got[filepath.ToSlash(rel)] = item.status
+		}
+
+		if len(got) != len(test.exp) {
+			t.Errorf("at conflict '%s' expected '%v' but got '%v'", test.conflict, test.exp, got)
+			continue
+		}
+		for path, status := range test.exp {
+			if got[path] != status {
+				t.Errorf("at conflict '%s' expected '%v' but got '%v'", test.conflict, test.exp, got)
+				break
+			}
+		}
+	}
+}
+
+func TestPlanPasteDanglingLink(t *testing.T) {
+	defer func(conflict string) { genOpts.pasteconflict = conflict }(genOpts.pasteconflict)
+	genOpts.pasteconflict = "rename"
+
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "file")
+	dst := filepath.Join(tmp, "dst")
+	if err := os.Mkdir(dst, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join(dst, "file")); err != nil {
+		t.Fatal(err)
+	}
+
+	items, _, err := planPaste([]string{src}, true, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item but got %d", len(items))
+	}
+	if items[0].path != filepath.Join(dst, "file.~1~") || items[0].status != "rename" {
+		t.Errorf("expected a dangling link at the destination to be renamed around but got '%+v'", items[0])
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	tmp := t.TempDir()
+
+	tests := []struct {
+		src string
+		dst string
+		ok  bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"foo", "", false},
+	}
+
+	for _, test := range tests {
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+
+		if err := os.WriteFile(src, []byte(test.src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dst, []byte(test.dst), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := verifyFile(src, dst); (err == nil) != test.ok {
+			t.Errorf("at input '%s' and '%s' expected verification '%t' but got error '%v'", test.src, test.dst, test.ok, err)
+		}
+	}
+}
+
+func TestRelativeLink(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{filepath.Join(tmp, "a", "b"), filepath.Join(tmp, "c")} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(tmp, "a", "b"), filepath.Join(tmp, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		src string
+		dir string
+		exp string
+	}{
+		{filepath.Join(tmp, "a", "file"), filepath.Join(tmp, "c"), filepath.Join("..", "a", "file")},
+		{filepath.Join(tmp, "c", "file"), filepath.Join(tmp, "link"), filepath.Join("..", "..", "c", "file")},
+		{filepath.Join(tmp, "link", "file"), filepath.Join(tmp, "c"), filepath.Join("..", "a", "b", "file")},
+		{filepath.Join(tmp, "link"), filepath.Join(tmp, "c"), filepath.Join("..", "link")},
+	}
+
+	for _, test := range tests {
+		if got, err := relativeLink(test.src, test.dir); err != nil || got != test.exp {
+			t.Errorf("at input '%s' and '%s' expected '%s' but got '%s' with error '%v'", test.src, test.dir, test.exp, got, err)
+		}
+	}
+}
+
+func TestCopyIntoSourceDir(t *testing.T) {
+	tmp := t.TempDir()
+
+	dir := filepath.Join(tmp, "d")
+	if err := os.Mkdir(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(tmp, "f"), filepath.Join(dir, "f")} {
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(s string) { genOpts.pasteconflict = s }(genOpts.pasteconflict)
+	genOpts.pasteconflict = "overwrite"
+
+	srcs := []string{filepath.Join(tmp, "f"), dir}
+	for _, src := range srcs {
+		if got, exp := copyDest(src, tmp), src+".~1~"; got != exp {
+			t.Errorf("at input '%s' expected '%s' but got '%s'", src, exp, got)
+		}
+	}
+
+	// destinations are the sources themselves when not renamed
+	always := func(src os.FileInfo, dst string) bool { return true }
+	if _, errs := waitProgress(copyAll(srcs, srcs, always, nil)); len(errs) != 2 {
+		t.Errorf("expected '2' errors but got '%v'", errs)
+	}
+	for _, path := range []string{filepath.Join(tmp, "f"), filepath.Join(dir, "f")} {
+		if b, err := os.ReadFile(path); err != nil || string(b) != "data" {
+			t.Errorf("expected '%s' to be kept but got '%s' and '%v'", path, b, err)
+		}
+	}
+}
+
+func TestPlanPasteSourceDir(t *testing.T) {
+	defer func(conflict string) { genOpts.pasteconflict = conflict }(genOpts.pasteconflict)
+	genOpts.pasteconflict = "overwrite"
+
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "file")
+	if err := os.WriteFile(src, []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	items, _, err := planPaste([]string{src}, true, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].path != src+".~1~" || items[0].status != "rename" {
+		t.Errorf("expected the copy to be renamed but got '%v'", items)
+	}
+}
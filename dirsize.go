@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dirSizeEntry is the cached total size of a directory along with the
+// modification time of the directory when the size is calculated.
+type dirSizeEntry struct {
+	size    int64
+	modTime time.Time
+}
+
+// dirSizes is the cache of the sizes calculated by 'calcdirsize' and the
+// 'autodirsize' option. Directories being calculated are kept in the pending
+// set so that they are not calculated twice at the same time.
+var dirSizes = struct {
+	mutex   sync.Mutex
+	sizes   map[string]dirSizeEntry
+	pending map[string]bool
+}{sizes: make(map[string]dirSizeEntry), pending: make(map[string]bool)}
+
+// cachedDirSize returns the cached size of the given directory. Cached sizes
+// are invalidated when the modification time of the directory changes.
+func cachedDirSize(path string, modTime time.Time) (int64, bool) {
+	dirSizes.mutex.Lock()
+	defer dirSizes.mutex.Unlock()
+
+	e, ok := dirSizes.sizes[path]
+	if !ok || !e.modTime.Equal(modTime) {
+		return 0, false
+	}
+	return e.size, true
+}
+
+// walkSize returns the total size of the given directory similar to copySize.
+// It stops when the given job is cancelled.
+func walkSize(path string, j *job) (int64, error) {
+	var total int64
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk: %s", err)
+		}
+		if err := j.check(); err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+// sizeKnown returns false for directories whose total sizes are not known.
+func (file *file) sizeKnown() bool {
+	if !file.IsDir() {
+		return true
+	}
+	_, ok := file.dirTotal()
+	return ok
+}
+
+// notifySizes notifies the main loop that directory sizes are updated, so that
+// files are sorted and drawn again.
+func (nav *nav) notifySizes() {
+	select {
+	case nav.sizeChan <- struct{}{}:
+	default:
+	}
+}
+
+// calcDirSizes calculates the sizes of the given directories in the background
+// as a job. Directories already being calculated are skipped. Errors are
+// reported in the message line unless quiet is true.
+func (nav *nav) calcDirSizes(app *app, paths []string, quiet bool) *job {
+	dirSizes.mutex.Lock()
+	var todo []string
+	for _, path := range paths {
+		if !dirSizes.pending[path] {
+			dirSizes.pending[path] = true
+			todo = append(todo, path)
+		}
+	}
+	dirSizes.mutex.Unlock()
+
+	if len(todo) == 0 {
+		return nil
+	}
+
+	j := nav.jobs.add("calcdirsize", filepath.Dir(todo[0]))
+	j.addTotalCount(int64(len(todo)))
+
+	go func() {
+		defer nav.jobs.remove(j)
+
+		for i, path := range todo {
+			if j.check() != nil {
+				dirSizes.mutex.Lock()
+				for _, path := range todo[i:] {
+					delete(dirSizes.pending, path)
+				}
+				dirSizes.mutex.Unlock()
+				return
+			}
+
+			// the time is read first so that changes during the walk invalidate the size
+			stat, err := os.Stat(path)
+			var size int64
+			if err == nil {
+				size, err = walkSize(path, j)
+			}
+
+			dirSizes.mutex.Lock()
+			delete(dirSizes.pending, path)
+			if err == nil {
+				dirSizes.sizes[path] = dirSizeEntry{size, stat.ModTime()}
+			}
+			dirSizes.mutex.Unlock()
+
+			j.addCount(1)
+
+			if err != nil && err != errJobCancelled && !quiet {
+				app.ui.exprChan <- &callExpr{"echoerr", []string{"calcdirsize: " + err.Error()}, 1}
+			}
+			nav.notifySizes()
+		}
+	}()
+
+	return j
+}
+
+// autoDirSizes calculates the sizes of the directories in the current
+// directory in the background when the 'autodirsize' option is enabled and
+// sizes are either sorted or shown. Calculations for a previous directory are
+// cancelled.
+func (nav *nav) autoDirSizes(app *app) {
+	if !genOpts.autodirsize || !nav.init {
+		return
+	}
+	shown := false
+	for _, s := range genOpts.info {
+		if s == "size" {
+			shown = true
+		}
+	}
+	if genOpts.sortType.method != sizeSort && (!shown || genOpts.dircounts) {
+		return
+	}
+
+	dir := nav.currDir()
+	if workDir(dir.path) != dir.path || dir.loading {
+		return
+	}
+
+	var paths []string
+	for _, f := range dir.allFiles {
+		if f.IsDir() && !f.sizeKnown() {
+			paths = append(paths, f.path)
+		}
+	}
+
+	if nav.autoSizeDir != dir.path {
+		for _, j := range nav.autoSizeJobs {
+			j.cancel()
+		}
+		nav.autoSizeJobs = nil
+		nav.autoSizeDir = dir.path
+	}
+
+	if j := nav.calcDirSizes(app, paths, true); j != nil {
+		nav.autoSizeJobs = append(nav.autoSizeJobs, j)
+	}
+}
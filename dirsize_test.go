@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDirSizes(t *testing.T) {
+	tmp := t.TempDir()
+
+	files := map[string]string{
+		"big/a":   "foobarbaz",
+		"small/b": "foo",
+		"unknown": "",
+	}
+	for name, data := range files {
+		path := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if name == "unknown" {
+			if err := os.Mkdir(path, os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"big", "small"} {
+		path := filepath.Join(tmp, name)
+		size, err := walkSize(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, err := copySize([]string{path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != exp {
+			t.Errorf("at input '%s' expected '%d' but got '%d'", path, exp, size)
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirSizes.mutex.Lock()
+		dirSizes.sizes[path] = dirSizeEntry{size, stat.ModTime()}
+		dirSizes.mutex.Unlock()
+	}
+
+	listed, err := readdir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := genOpts.sortType
+	defer func() { genOpts.sortType = prev }()
+
+	for _, option := range []sortOption{0, reverseSort} {
+		d := &dir{path: tmp, allFiles: listed}
+		genOpts.sortType = sortType{sizeSort, option}
+		d.sort()
+
+		var got []string
+		for _, f := range d.files {
+			got = append(got, f.Name())
+		}
+		exp := []string{"small", "big", "unknown"}
+		if option&reverseSort != 0 {
+			exp = []string{"big", "small", "unknown"}
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("at option '%v' expected '%v' but got '%v'", option, exp, got)
+		}
+	}
+
+	path := filepath.Join(tmp, "small")
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cachedDirSize(path, stat.ModTime()); !ok {
+		t.Errorf("size of '%s' should be cached", path)
+	}
+	if _, ok := cachedDirSize(path, stat.ModTime().Add(time.Second)); ok {
+		t.Errorf("size of '%s' should be invalidated when modified", path)
+	}
+}
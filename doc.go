@@ -35,11 +35,26 @@ The following commands are provided by fm:
 	unselect                 (default 'u')
 	glob-select
 	glob-unselect
+	selection-save
+	selection-load
+	selection-list
 	calcdirsize
 	copy                     (default 'y')
 	cut                      (default 'd')
+	copy-append
+	cut-append
 	paste                    (default 'p')
+	paste-preview
+	paste-symlink
+	paste-relative-symlink
+	paste-hardlink
 	clear                    (default 'c')
+	register       (modal)
+	registers
+	yank-path
+	yank-name
+	yank-dir
+	paste-from-clipboard
 	sync
 	draw
 	redraw                   (default '<c-l>')
@@ -51,7 +66,29 @@ The following commands are provided by fm:
 	cd
 	select
 	delete         (modal)
+	trash
+	trash-restore  (modal)
+	trash-empty    (modal)
+	undo
+	redo
+	jobs
+	job-cancel
+	job-pause
 	rename         (modal)   (default 'r')
+	bulk-rename
+	rename-pattern
+	mkdir
+	mkdir-cd
+	touch
+	archive
+	extract
+	find-duplicates
+	flatten
+	du
+	du-exit
+	chmod
+	chown
+	chmod-edit     (modal)   (default 'P')
 	source
 	push
 	read           (modal)   (default ':')
@@ -108,10 +145,16 @@ The following command line commands are provided by fm:
 The following options can be used to customize the behavior of fm:
 
 	anchorfind       bool      (default on)
+	archivedirs      bool      (default on)
+	autodirsize      bool      (default off)
 	autoquit         bool      (default off)
 	cleaner          string    (default '')
+	clipboardcopy    string    (default '')
+	clipboardpaste   string    (default '')
+	copyworkers      int       (default 1)
 	cursorfmt        string    (default "\033[7m")
 	cursorpreviewfmt string    (default "\033[4m")
+	deletemode       string    (default 'delete')
 	dircache         bool      (default on)
 	dircounts        bool      (default off)
 	dirfirst         bool      (default on)
@@ -136,9 +179,12 @@ The following options can be used to customize the behavior of fm:
 	infotimefmtold   string    (default 'Jan _2  2006')
 	mouse            bool      (default off)
 	number           bool      (default off)
+	pasteconflict    string    (default 'rename')
 	period           int       (default 0)
+	preserve         []string  (default 'mode')
 	preview          bool      (default on)
 	previewer        string    (default '')
+	progressbar      bool      (default off)
 	promptfmt        string    (default "\033[32;1m%u@%h\033[0m:\033[34;1m%d\033[0m\033[1m%f\033[0m")
 	ratios           []int     (default '1:2:3')
 	relativenumber   bool      (default off)
@@ -156,7 +202,9 @@ The following options can be used to customize the behavior of fm:
 	tempmarks        string    (default '')
 	timefmt          string    (default 'Mon Jan _2 15:04:05 2006')
 	truncatechar     string    (default '~')
+	verifycopy       bool      (default off)
 	waitmsg          string    (default 'Press any key to continue')
+	watch            bool      (default on)
 	wrapscan         bool      (default on)
 	wrapscroll       bool      (default off)
 	user_{option}    string    (default none)
@@ -178,6 +226,7 @@ The following environment variables are exported for shell commands:
 	fm_user_{option}
 	fm_width
 	fm_height
+	fm_progress_{field}
 
 The following special shell commands are used to customize the behavior of fm
 when defined:
@@ -186,6 +235,7 @@ when defined:
 	paste
 	rename
 	delete
+	trash
 	pre-cd
 	on-cd
 	on-select
@@ -260,11 +310,25 @@ Tags file should be located at:
 	Unix     ~/.local/share/fm/tags
 	Windows  C:\Users\<user>\AppData\Local\fm\tags
 
+Selection sets directory should be located at:
+
+	Unix     ~/.local/share/fm/selections
+	Windows  C:\Users\<user>\AppData\Local\fm\selections
+
 History file should be located at:
 
 	Unix     ~/.local/share/fm/history
 	Windows  C:\Users\<user>\AppData\Local\fm\history
 
+Journal file should be located at:
+
+	Unix     ~/.local/share/fm/journal
+	Windows  C:\Users\<user>\AppData\Local\fm\journal
+
+Trash directory should be located at:
+
+	Unix     ~/.local/share/Trash
+
 You can configure the default values of following variables to change these
 locations:
 
@@ -300,8 +364,9 @@ Change the current working directory to the parent directory.
 
 	open                     (default 'l' and '<right>')
 
-If the current file is a directory, then change the current directory to it,
-otherwise, execute the 'open' command. A default 'open' command is provided
+If the current file is a directory, or an archive when 'archivedirs' is
+enabled, then change the current directory to it, otherwise, execute the 'open'
+command. A default 'open' command is provided
 to call the default system opener asynchronously with the current file as the
 argument. A custom 'open' command can be defined to override this default.
 
@@ -342,12 +407,27 @@ Remove the selection of all files in all directories.
 
 Select/unselect files that match the given glob.
 
+	selection-save
+	selection-load
+	selection-list
+
+Save all selected files as a named selection set, replace the current
+selections with a saved set, or list the saved sets in a menu (e.g.
+'selection-save photos' and 'selection-load photos'). Sets are kept in the data
+directory so they persist across sessions, and they are loaded back in the
+order the files were selected. Files in a set that no longer exist are dropped
+with a warning when the set is loaded. Saving a set with an existing name
+replaces it.
+
 	calcdirsize
 
-Calculate the total size for each of the selected directories. Option 'info'
-should include 'size' and option 'dircounts' should be disabled to show this
-size. If the total size of a directory is not calculated, it will be shown as
-'-'.
+Calculate the total size for each of the selected directories, or the current
+directory if none is selected. Sizes are calculated in the background as a job,
+which can be cancelled with 'job-cancel'. Calculated sizes are kept until the
+modification time of the directory changes. Option 'info' should include 'size'
+and option 'dircounts' should be disabled to show this size. If the total size
+of a directory is not calculated, it will be shown as '-'. When sorting by size,
+directories with unknown sizes are shown after the others.
 
 	copy                     (default 'y')
 
@@ -359,15 +439,87 @@ buffer, otherwise, copy the paths of selected files.
 If there are no selections, save the path of the current file to the cut buffer,
 otherwise, copy the paths of selected files.
 
+	copy-append
+	cut-append
+
+Add the path of the current file or the paths of selected files to the files
+already in the copy/cut buffer instead of replacing them, which can be used to
+gather files from several directories for a single paste. Files already in the
+buffer are not added twice. Appending fails if the buffer holds files for the
+other operation.
+
 	paste                    (default 'p')
 
 Copy/Move files in copy/cut buffer to the current working directory. A custom
-'paste' command can be defined to override this default.
+'paste' command can be defined to override this default. Named pipes and device
+nodes are recreated instead of copying their contents, which usually requires
+privileges for device nodes, and sockets are skipped with an error. Holes in
+sparse files are preserved where the filesystem supports it.
+
+	paste-preview
+
+Show the files that would be created by the builtin 'paste' command in a menu
+without changing anything, and ask for confirmation to paste them. Files that
+already exist are shown with how they would be handled according to
+'pasteconflict' option, and files that would be moved across devices by copying
+are marked as cross-device. The total size of files to be pasted is shown in the
+prompt.
+
+	paste-symlink
+	paste-relative-symlink
+	paste-hardlink
+
+Create symbolic links with absolute targets, symbolic links with relative
+targets, or hard links to the files in copy/cut buffer in the current working
+directory. Existing files are handled according to 'pasteconflict' option as in
+'paste', except that existing directories are never replaced. Relative targets
+are computed from the real directories of the files, so they are correct even
+when the directories are reached through symbolic links. The copy/cut buffer is
+kept after linking.
 
 	clear                    (default 'c')
 
 Clear file paths in copy/cut buffer.
 
+	register       (modal)
+	registers
+
+Commands working with the copy/cut buffer, which are 'copy', 'cut',
+'copy-append', 'cut-append', 'paste', 'paste-preview', 'paste-symlink',
+'paste-relative-symlink', 'paste-hardlink', and 'clear', take an optional named
+register in the argument instead of the copy/cut buffer. Named registers are
+single lowercase letters, and each of them holds its own list of files to copy
+or move, kept in the data directory. The copy/cut buffer is the unnamed register
+'"'. Only files in the copy/cut buffer are highlighted.
+The 'register' command reads a register name and uses it for the next command
+typed with a key, so that it works similar to registers in vim when it is
+mapped to a key:
+
+	map '"' register
+
+Then '"ay' copies the current file to the register 'a' and '"ap' pastes it.
+Note that '"' is mapped to 'mark-remove' by default. The 'registers' command
+lists the registers holding files in a menu.
+
+	yank-path
+	yank-name
+	yank-dir
+
+Put the path, the name, or the directory of the current file, or the ones of
+selected files one per line, on the system clipboard. The command in
+'clipboardcopy' option is used if it is set, otherwise the clipboard is set
+with the OSC 52 escape sequence, which works over SSH in terminals supporting
+it without any clipboard tools. Custom 'yank-path', 'yank-name' and 'yank-dir'
+commands can be defined to override these defaults.
+
+	paste-from-clipboard
+
+Read a newline separated list of paths from the system clipboard using the
+command in 'clipboardpaste' option, and save them to the copy buffer to be
+copied with 'paste'. Relative paths are relative to the current directory, and
+'file://' URIs are accepted as well. Paths of files that do not exist are
+reported as an error and left out.
+
 	sync
 
 Synchronize copied/cut files with server. This command is automatically called
@@ -414,14 +566,196 @@ Change the current file selection to the given argument.
 
 	delete         (modal)
 
-Remove the current file or selected file(s). A custom 'delete' command can be
+Remove the current file or selected file(s). Files are moved to the trash
+instead when 'deletemode' is set to 'trash'. A custom 'delete' command can be
 defined to override this default.
 
+	trash
+
+Move the current file or selected file(s) to the trash without confirmation.
+Trashed files are stored according to the FreeDesktop.org Trash specification
+so they can also be restored by other applications. Files on the same device as
+the home trash directory are moved there, and files on other devices are moved
+to '.Trash/$uid' or '.Trash-$uid' directories at the top of their mount.
+A custom 'trash' command can be defined to override this default.
+
+	trash-restore  (modal)
+
+Restore the given files from the trash to their original locations. File names
+are given with their original paths, either absolute or relative to the current
+directory. When there are multiple trashed files with the same path, the most
+recently trashed one is restored. Restoring a file fails if a file already
+exists at its original location. When called without arguments, files trashed
+from the current directory are listed and a name is prompted.
+
+	trash-empty    (modal)
+
+Permanently remove all files in the trash after a confirmation. This includes
+the home trash directory and the trash directory of the mount of the current
+directory.
+
+	undo
+	redo
+
+Undo the last file operation or redo the last undone one. Builtin 'paste',
+links created with 'paste-symlink', 'paste-relative-symlink' and
+'paste-hardlink', 'rename' and 'trash' operations are recorded in a journal, as
+well as 'delete' when 'deletemode' is set to 'trash'. Undoing a copy removes the
+copied files, undoing a link removes the created links, undoing a move or rename
+moves the files back, and undoing a trash restores the files from the trash.
+Files are checked before undoing or redoing an operation, and nothing is done if
+they are modified, moved or replaced since then, including files inside copied
+directories. Files removed permanently and operations performed by custom
+commands can not be undone.
+
+	jobs
+
+Show the running file operations in a menu. Builtin 'paste', 'paste-symlink',
+'paste-relative-symlink', 'paste-hardlink', 'archive', 'extract', 'delete',
+'trash', 'undo', and 'redo' operations run in the background as jobs, each with
+a unique id. The menu shows the id, the type, the status, the progress, the
+elapsed time, and the path of each job.
+
+	job-cancel
+	job-pause
+
+Cancel or pause the job with the id given in the argument. The id can be omitted
+when there is only a single running job. Pausing a paused job resumes it.
+Cancelling a copy operation removes the partially written file, and cancelling a
+move across devices removes the partially copied files, while the files that
+are already processed are kept.
+
 	rename         (modal)   (default 'r')
 
 Rename the current file using the builtin method. A custom 'rename' command can
 be defined to override this default.
 
+	bulk-rename
+
+Rename the selected files, or all files in the current directory if there are
+no selections, using the editor. The names of the files are written to a
+temporary file one per line, which is opened with '$EDITOR' ('%EDITOR%' on
+Windows). After the editor is closed, each file is renamed to the name in the
+corresponding line. Names are relative to the current directory. Nothing is
+renamed if the number of lines is changed, a line is empty, two files are
+renamed to the same name, or a file is renamed to the name of an existing file
+that is not renamed itself. Files can swap their names, in which case temporary
+names are used. Renamed files are shown in a menu and the operation is recorded
+in the journal to be undone as a whole. A custom 'bulk-rename' command can be
+defined to override this default.
+
+	rename-pattern
+
+Rename the selected files, or the current file if there are no selections, by
+replacing the matches of a regular expression in their names. The first argument
+is the expression and the second argument is the replacement, which can refer to
+submatches as '$1' or '${1}', and '$$' is a literal '$'. The replacement can
+also contain a counter as '{n}', which is incremented for each matching file
+starting from 1, or '{n:W}' to pad it with zeros to width 'W'. Text following
+'\U' or '\L' is converted to upper or lower case until the end of the name or
+'\E'. Renamed files are shown in a menu before renaming and confirmation is
+asked. Similar to 'rename', the user is asked to create missing directories and
+to replace existing files. For example, the following swaps the parts around the
+first underscore in the names of the selected files:
+
+	rename-pattern '([^_]*)_(.*)' '$2_$1'
+
+	mkdir
+	mkdir-cd
+	touch
+
+Create directories or empty files with the names given in the arguments. Names
+are relative to the current directory unless they are absolute, and '~' is
+expanded to the home directory. Parent directories are created as needed.
+Existing directories are kept as is, and access and modification times of
+existing files are updated. The last created file is selected afterwards, or it
+is changed to with 'mkdir-cd'. Custom 'mkdir', 'mkdir-cd', and 'touch'
+commands can be defined to override these defaults.
+
+	archive
+
+Create an archive containing the selected files, or the current file if there
+are no selections. The name of the archive is given in the argument, and its
+extension decides the format, which can be '.tar', '.tar.gz', '.tgz', or
+'.zip'. Files are stored with their paths relative to the current directory.
+Special files are skipped. Archiving runs in the background and its progress is
+shown in the ruler as in 'paste'.
+
+	extract
+
+Extract the archive under the cursor into the directory given in the argument,
+or the current directory if no argument is given. Supported formats are the
+same as 'archive'. Entries that would be extracted outside of the directory,
+such as absolute paths, paths containing '..', or paths through symbolic links
+pointing outside, are rejected with an error. Existing files are handled
+according to 'pasteconflict' option, and existing directories are merged.
+Extracting runs in the background and its progress is shown in the ruler as in
+'paste'. Custom 'archive' and 'extract' commands can be defined to override
+these defaults.
+
+	find-duplicates
+
+Find regular files with identical contents in the directory given in the
+argument, or the current directory if no argument is given, including its
+subdirectories. Files are compared by size first, then by the checksum of their
+first 64KiB, and only then by the checksum of their whole contents. Empty
+files, symbolic links, and hard links to the same file are ignored. Searching
+runs in the background as a job. When it is done, the current directory is
+changed to a virtual listing of the duplicate sets, where each file is shown
+with its path relative to the searched directory prefixed by the number of its
+set, with larger files first. Files in the listing can be selected and deleted
+as usual, and deleted files are removed from the listing. Since the listing does
+not exist on disk, commands such as 'mkdir', 'touch', 'paste' and 'extract' use
+the searched directory instead, and 'rename' starts with the real file name.
+
+	flatten
+
+Show all files and directories under the current directory as one list, down to
+the depth given in the argument, or without a limit if no argument is given
+(e.g. 'flatten 2' shows the files in the current directory and in its
+subdirectories). The current directory is changed to a virtual listing where
+each file is shown with its path relative to the flattened directory. Sorting,
+filters, searching and selections work on the listing as in other directories,
+and going up leaves the listing. The directory is walked again on 'reload' and
+when the watcher reports changes in the flattened directory, while 'load' and
+file operations only drop the files that no longer exist. As in the listing of
+'find-duplicates', commands creating files use the flattened directory.
+Hidden files and directories are left out unless the option 'hidden' is
+enabled, and symbolic links to directories are not followed.
+
+	du
+	du-exit
+
+Start the disk usage mode for the directory given in the argument, or the
+current directory if no argument is given. The whole tree is scanned once in
+the background as a job, and the total sizes of all directories in the tree
+are shown as in 'calcdirsize' while the scan refines them. Files are sorted by
+decreasing size, and the info column shows the percentage of the size of each
+file in its directory along with a bar. Running 'du' again restarts the scan.
+Use 'du-exit' to stop the mode, which restores the sort order from before the
+mode started unless it is changed while the mode is active. Sizes are apparent
+sizes, and hard links are counted each time.
+
+	chmod
+	chown
+
+Change the mode or the owner of the selected files, or the current file if
+there are no selections. The mode is given in the argument either in octal
+such as '755' or in symbolic form such as 'u+x,go-w' as in chmod(1). Symbolic
+modes without classes apply to all classes regardless of the umask. The owner
+is given as 'user', 'user:group', or ':group', with names or numeric ids.
+Directories are changed recursively when '-R' is given before the argument, in
+which case symbolic links inside directories are not followed. Custom 'chmod'
+and 'chown' commands can be defined to override these defaults.
+
+	chmod-edit     (modal)   (default 'P')
+
+Show the permissions of the current file in a menu. Keys '1' to '9' toggle the
+read, write, and execute bits of the user, group, and other classes
+respectively, and 'u', 'g', and 't' toggle the setuid, setgid, and sticky bits.
+Changes are applied with 'cmd-enter' and discarded with 'cmd-escape'. Key 'o'
+switches to a prompt to edit the owner and group as in 'chown'.
+
 	source
 
 Read the configuration file given in the argument.
@@ -601,6 +935,25 @@ Character ':' is used as the separator for list options '[]int' and '[]string'.
 When this option is enabled, find command starts matching patterns from the
 beginning of file names, otherwise, it can match at an arbitrary position.
 
+	archivedirs    bool      (default on)
+
+Browse '.tar', '.tar.gz', '.tgz' and '.zip' archives as directories. Opening an
+archive shows its entries, and files inside the archive are previewed without
+the previewer. Entries can be copied out of the archive with 'copy' and
+'paste', but archives can not be modified, and shell commands are not run on
+files inside archives. Builtin file operations such as 'delete', 'trash',
+'rename', 'chmod', and 'mkdir' on files inside archives fail with an error.
+The working directory is set to the directory of the archive while browsing it.
+This option is enabled by default, so opening an archive no longer runs the
+opener on it. Use 'set noarchivedirs' to open archives with the opener instead.
+
+	autodirsize    bool      (default off)
+
+Calculate the total sizes of the directories in the current directory
+automatically as in 'calcdirsize' when files are sorted by size or 'info'
+includes 'size'. Calculations for the previous directory are cancelled when the
+current directory changes.
+
 	autoquit       bool      (default off)
 
 Automatically quit server when there are no clients left connected.
@@ -614,6 +967,25 @@ file, (1) current file name, (2) width, (3) height, (4) horizontal position,
 and (5) vertical position of preview pane respectively. Preview clearing is
 disabled when the value of this option is left empty.
 
+	clipboardcopy  string    (default '') (OSC 52 used if empty)
+
+Set the shell command used to put text on the system clipboard by 'yank-path',
+'yank-name' and 'yank-dir'. The text is written to the standard input of the
+command (e.g. 'xclip -selection clipboard', 'wl-copy' or 'pbcopy').
+
+	clipboardpaste string    (default '') (not called if empty)
+
+Set the shell command used to read text from the system clipboard by
+'paste-from-clipboard'. The text is read from the standard output of the
+command (e.g. 'xclip -selection clipboard -o', 'wl-paste' or 'pbpaste').
+
+	copyworkers    int       (default 1)
+
+Set the number of files copied in parallel by builtin copy operations. Only
+files smaller than 1MiB are copied in parallel, and larger files are still
+copied one at a time. Increasing this value may speed up copying many small
+files, especially on network filesystems.
+
 	cursorfmt         string    (default "\033[7m")
 	cursorpreviewfmt  string    (default "\033[4m")
 
@@ -628,6 +1000,12 @@ If the format string contains the characters '%s', it is interpreted as a format
 string for 'fmt.Sprintf'. Such a string should end with the terminal reset
 sequence. For example, "\033[4m%s\033[0m" has the same effect as "\033[4m".
 
+	deletemode     string    (default 'delete')
+
+Set the behavior of the builtin 'delete' command. Currently supported modes are
+'delete' to remove files permanently, and 'trash' to move files to the trash so
+they can be restored with 'trash-restore'.
+
 	dircache       bool      (default on)
 
 Cache directory contents.
@@ -758,6 +1136,19 @@ Show the position number for directory items at the left side of pane. When
 'relativenumber' option is enabled, only the current line shows the absolute
 position and relative positions are shown for the rest.
 
+	pasteconflict  string    (default 'rename')
+
+Set how builtin 'paste' command handles files that already exist in the
+destination. Currently supported values are 'rename' to add a numbered suffix
+to the new files, 'skip' to keep the existing files, 'overwrite' to replace the
+existing files, 'newer' to replace the existing files only when the new files
+have a more recent modification time, and 'ask' to prompt for each file. The
+prompt accepts 'y' to replace the file, 'n' to keep it, 'a' to replace this and
+all the following files, and 's' to keep this and all the following files of
+the operation. Except for 'rename', existing directories are merged and the
+setting is applied to each file inside. Files copied into their own directory
+are always renamed regardless of this setting.
+
 	period         int       (default 0)
 
 Set the interval in seconds for periodic checks of directory updates. This works
@@ -765,7 +1156,18 @@ by periodically calling the 'load' command. Note that directories are already
 updated automatically in many cases. This option can be useful when there is an
 external process changing the displayed directory and you are not doing anything
 in fm. Periodic checks are disabled when the value of this option is set to
-zero.
+zero. Option 'watch' updates the displayed directories without periodic checks
+where it is available.
+
+	preserve       []string  (default 'mode')
+
+List of file attributes preserved by builtin copy operations, including moves
+across devices. Currently supported attributes are 'mode', 'timestamps',
+'owner', and 'xattr'. When 'mode' is not preserved, new files are created with
+the mode of the original files masked by the umask. Owner is only preserved
+when the user is permitted to change it. Extended attributes are only preserved
+on Linux. Attributes of directories are applied after their contents are
+copied.
 
 	preview        bool      (default on)
 
@@ -786,6 +1188,13 @@ file is selected in the future, the previewer is called once again. Preview
 filtering is disabled and files are displayed as they are when the value of this
 option is left empty.
 
+	progressbar    bool      (default off)
+
+Show the progress of the oldest running job in a separate line above the status
+line as a bar along with the processed and total amounts, the name of the
+current file, the speed, and the estimated remaining time. These details are
+shown in the ruler instead when this option is disabled.
+
 	promptfmt      string    (default "\033[32;1m%u@%h\033[0m:\033[34;1m%d\033[0m\033[1m%f\033[0m")
 
 Format string of the prompt shown in the top line. Special expansions are
@@ -880,10 +1289,29 @@ Format string of the file modification time shown in the bottom line.
 
 Truncate character shown at the end when the file name does not fit to the pane.
 
+	verifycopy     bool      (default off)
+
+Verify the contents of each file copied by builtin copy operations, including
+cross-device moves, by comparing checksums of the source and the destination
+after writing. The destination is synced to the disk and read back where
+possible. Files with mismatching checksums are removed and reported as errors,
+and the source files of cross-device moves are not deleted when any file fails
+verification.
+
 	waitmsg        string    (default 'Press any key to continue')
 
 String shown after commands of shell-wait type.
 
+	watch          bool      (default on)
+
+Watch the directories shown in the panes and the previewed directory for
+changes, and reload them when files are created, deleted or renamed in them.
+Reloads are delayed slightly so that directories with many changes are not
+reloaded for each of them. Watching uses inotify and is only available on
+Linux. When watching is not possible, the option is disabled and directories
+are only updated by checking their modification times when they are loaded or
+with the 'period' option.
+
 	wrapscan       bool      (default on)
 
 Searching can wrap around the file list.
@@ -968,6 +1396,25 @@ Value of the user_{option}.
 	fm_height
 
 Width/Height of the terminal.
+
+	fm_progress_jobs
+	fm_progress_kind
+	fm_progress_file
+	fm_progress_unit
+	fm_progress_done
+	fm_progress_total
+	fm_progress_percent
+	fm_progress_speed
+	fm_progress_eta
+
+Progress of the oldest running job with a known total, which can be used by
+shell commands to show it elsewhere. 'jobs' is the number of running jobs,
+'kind' is the kind of the job such as 'copy', 'file' is the path of the file
+currently being processed, and 'unit' is either 'bytes' or 'items'. 'done' and
+'total' are the processed and total amounts in this unit, 'speed' is the amount
+processed per second over the last second, and 'eta' is the estimated remaining
+time in seconds. Variables other than 'jobs' are empty if there is no such job,
+and 'eta' is also empty when the job is stalled.
 # Special Commands
 This section shows information about special shell commands.
 
@@ -988,6 +1435,10 @@ This shell command can be defined to override the default 'rename' command.
 
 This shell command can be defined to override the default 'delete' command.
 
+	trash
+
+This shell command can be defined to override the default 'trash' command.
+
 	pre-cd
 
 This shell command can be defined to be executed before changing a directory.
@@ -1294,16 +1745,29 @@ not be needed for users.
 # File Operations
 fm uses its own builtin copy and move operations by default. These are
 implemented as asynchronous operations and progress is shown in the bottom
-ruler. These commands do not overwrite existing files or directories with
-the same name. Instead, a suffix that is compatible with '--backup=numbered'
-option in GNU cp is added to the new files or directories. Only file modes are
-preserved and all other attributes are ignored including ownership, timestamps,
-context, and xattr. Special files such as character and block devices, named
-pipes, and sockets are skipped and links are not followed. Moving is performed
-using the rename operation of the underlying OS. For cross-device moving,
-fm falls back to copying and then deletes the original files if there are no
-errors. Operation errors are shown in the message line as well as the log file
-and they do not preemptively finish the corresponding file operation.
+ruler. By default, these commands do not overwrite existing files or
+directories with the same name. Instead, a suffix that is compatible with
+'--backup=numbered' option in GNU cp is added to the new files or directories.
+This behavior can be changed with 'pasteconflict' option. Only file modes are
+preserved by default and other attributes such as ownership, timestamps, and
+xattr can be preserved with 'preserve' option. File contents are copied with
+reflinks when the filesystem supports them, and with kernel copy functions or a
+large buffer otherwise. Holes in sparse files are preserved. Named pipes and
+device nodes are recreated, sockets are skipped with an error, and links are not
+followed. Moving is performed using the rename operation of the underlying OS.
+For cross-device moving, fm falls back to copying and then deletes the original
+files if there are no errors. Operation errors are shown in the message line as
+well as the log file and they do not preemptively finish the corresponding file
+operation.
+Running file operations can be listed with 'jobs', and they can be paused with
+'job-pause' and cancelled with 'job-cancel'. The progress of file operations is
+shown in the ruler along with the name of the current file, the speed, and the
+estimated remaining time, or in a separate line when 'progressbar' option is
+enabled. The speed is measured over the last second, so it drops to zero when an
+operation stalls.
+Builtin file operations are recorded in a journal so that they can be reverted
+with 'undo' and performed again with 'redo'. Files replacing or merged into
+existing files are not recorded.
 File operations can be performed on the current selected file or alternatively
 on multiple files by selecting them first. When you 'copy' a file, fm doesn't
 actually copy the file on the disk, but only records its name to a file.
@@ -1333,9 +1797,10 @@ it (i.e. GNU implementation), change the command type to asynchronous, or use
 the client periodically with remote 'echo' calls.
 By default, fm does not assign 'delete' command to a key to protect new users.
 You can customize file deletion by defining a 'delete' command. You can also
-assign a key to this command if you like. An example command to move selected
-files to a trash folder and remove files completely after a prompt are provided
-in the example configuration file.
+assign a key to this command if you like. Alternatively, you can use the builtin
+'trash' command or set 'deletemode' option to 'trash' to move files to the trash
+instead. Trashed files can be restored with 'trash-restore' and removed
+completely with 'trash-empty'.
 # Searching Files
 There are two mechanisms implemented in fm to search a file in the current
 directory. Searching is the traditional method to move the selection to a file
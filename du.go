@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// duScan is the scan of a directory tree in the 'du' mode. Sizes of all
+// directories in the tree are updated while the scan is running, so that they
+// can be shown before the scan is done.
+type duScan struct {
+	root  string
+	mutex sync.Mutex
+	sizes map[string]int64
+}
+
+// duCurrent is the scan of the active 'du' mode, or nil if it is not active.
+var duCurrent atomic.Pointer[duScan]
+
+// interval between refreshes of the sizes shown while scanning
+const duUpdateInterval = 200 * time.Millisecond
+
+// size returns the total size of the given directory if it is in the tree.
+func (s *duScan) size(path string) (int64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	size, ok := s.sizes[path]
+	return size, ok
+}
+
+// add adds the given size to the given directory and its parents in the tree.
+func (s *duScan) add(dir string, size int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		s.sizes[dir] += size
+		if dir == s.root {
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// run scans the tree and calls the given function periodically while sizes
+// are updated. Sizes are apparent sizes as in 'calcdirsize'.
+func (s *duScan) run(j *job, update func()) error {
+	last := time.Now()
+
+	return filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == s.root {
+				return err
+			}
+			log.Printf("du: %s", err)
+			return nil
+		}
+		if err := j.check(); err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			log.Printf("du: %s", err)
+			return nil
+		}
+
+		j.addCount(1)
+
+		if d.IsDir() {
+			s.add(path, info.Size())
+		} else {
+			s.add(filepath.Dir(path), info.Size())
+		}
+
+		if time.Since(last) >= duUpdateInterval {
+			update()
+			last = time.Now()
+		}
+
+		return nil
+	})
+}
+
+// dirTotal returns the total size of the directory if it is known, either from
+// the 'du' mode or from 'calcdirsize'.
+func (file *file) dirTotal() (int64, bool) {
+	if s := duCurrent.Load(); s != nil {
+		if size, ok := s.size(file.path); ok {
+			return size, true
+		}
+	}
+	return cachedDirSize(file.path, file.ModTime())
+}
+
+// duBar returns the percentage of the size of the given file in its directory
+// along with a bar, or an empty string if the 'du' mode is not active or the
+// directory is not in the scanned tree.
+func duBar(f *file, d *dir) string {
+	s := duCurrent.Load()
+	if s == nil {
+		return ""
+	}
+
+	total, ok := s.size(d.path)
+	if !ok {
+		return ""
+	}
+
+	pct := 0.0
+	if total > 0 {
+		pct = float64(f.TotalSize()) * 100 / float64(total)
+	}
+
+	return fmt.Sprintf("%5.1f%% [%-10s]", pct, strings.Repeat("#", int(pct/10+0.5)))
+}
+
+// duStart starts the 'du' mode for the given directory. Files are sorted by
+// decreasing size until the mode is stopped, and the previous sort type is
+// restored afterwards.
+func (nav *nav) duStart(app *app, root string) {
+	if nav.duJob != nil {
+		nav.duJob.cancel()
+	} else {
+		nav.duSortType = genOpts.sortType
+	}
+
+	s := &duScan{root: root, sizes: make(map[string]int64)}
+	duCurrent.Store(s)
+
+	genOpts.sortType = sortType{sizeSort, genOpts.sortType.option&^dirfirstSort | reverseSort}
+	nav.duModeSortType = genOpts.sortType
+
+	j := nav.jobs.add("du", root)
+	nav.duJob = j
+
+	update := nav.notifySizes
+
+	go func() {
+		defer nav.jobs.remove(j)
+
+		start := time.Now()
+		err := s.run(j, update)
+		update()
+
+		switch {
+		case err == errJobCancelled:
+		case err != nil:
+			app.ui.exprChan <- &callExpr{"echoerr", []string{"du: " + err.Error()}, 1}
+		default:
+			size, _ := s.size(root)
+			_, _, count, _ := j.progress()
+			msg := fmt.Sprintf("du: scanned %s in %d files in %s", humanize(size), count, time.Since(start).Round(time.Millisecond))
+			app.ui.exprChan <- &callExpr{"echo", []string{msg}, 1}
+		}
+	}()
+}
+
+// duStop stops the 'du' mode and restores the previous sort type, unless the
+// sort type is changed while the mode is active.
+func (nav *nav) duStop() bool {
+	if nav.duJob == nil {
+		return false
+	}
+
+	nav.duJob.cancel()
+	nav.duJob = nil
+	duCurrent.Store(nil)
+	if genOpts.sortType == nav.duModeSortType {
+		genOpts.sortType = nav.duSortType
+	}
+
+	return true
+}
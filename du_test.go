@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDuScan(t *testing.T) {
+	tmp := t.TempDir()
+
+	files := map[string]string{
+		"a":         "foo",
+		"dir/b":     "barbaz",
+		"dir/sub/c": "qux",
+	}
+	for name, data := range files {
+		path := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &duScan{root: tmp, sizes: make(map[string]int64)}
+	if err := s.run(nil, func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{tmp, filepath.Join(tmp, "dir"), filepath.Join(tmp, "dir", "sub")} {
+		exp, err := copySize([]string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := s.size(dir); !ok || got != exp {
+			t.Errorf("at input '%s' expected '%d' but got '%d'", dir, exp, got)
+		}
+	}
+
+	if _, ok := s.size(filepath.Dir(tmp)); ok {
+		t.Errorf("directories outside of the root should not have sizes")
+	}
+}
+
+func TestDuStopSortType(t *testing.T) {
+	defer func(st sortType) { genOpts.sortType = st }(genOpts.sortType)
+
+	prev := sortType{naturalSort, dirfirstSort}
+	mode := sortType{sizeSort, reverseSort}
+	changed := sortType{timeSort, 0}
+
+	tests := []struct {
+		curr sortType
+		exp  sortType
+	}{
+		{mode, prev},
+		{changed, changed},
+	}
+
+	for _, test := range tests {
+		nav := newNav(10)
+		nav.duJob = nav.jobs.add("du", "/")
+		nav.duSortType = prev
+		nav.duModeSortType = mode
+		genOpts.sortType = test.curr
+
+		nav.duStop()
+		if genOpts.sortType != test.exp {
+			t.Errorf("at input '%v' expected '%v' but got '%v'", test.curr, test.exp, genOpts.sortType)
+		}
+	}
+}
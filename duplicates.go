@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// number of bytes read from the beginning of files to compare them before
+// reading whole files
+const duplicatePartialSize = 64 << 10
+
+// partialChecksum returns the checksum of the beginning of the given file.
+func partialChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, duplicatePartialSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// splitGroups splits each of the given groups of files by the key returned by
+// the given function. Groups with less than two files are dropped, and files
+// for which the function fails are left out.
+func splitGroups(groups [][]string, key func(path string) (string, error), j *job) ([][]string, error) {
+	var result [][]string
+	for _, group := range groups {
+		byKey := make(map[string][]string)
+		var keys []string
+		for _, path := range group {
+			if err := j.check(); err != nil {
+				return nil, err
+			}
+			k, err := key(path)
+			if err != nil {
+				log.Printf("finding duplicates: %s", err)
+				continue
+			}
+			if _, ok := byKey[k]; !ok {
+				keys = append(keys, k)
+			}
+			byKey[k] = append(byKey[k], path)
+		}
+		for _, k := range keys {
+			if len(byKey[k]) > 1 {
+				result = append(result, byKey[k])
+			}
+		}
+	}
+	return result, nil
+}
+
+// findDuplicates returns the sets of regular files with identical contents in
+// the given directory. Files are first grouped by size, then by the checksum of
+// their beginnings, and then by the checksum of their whole contents, so that
+// most files are never read completely. Empty files, symbolic links, and hard
+// links to the same file are ignored. Sets are sorted by decreasing size.
+func findDuplicates(root string, j *job) ([][]string, error) {
+	bySize := make(map[int64][]string)
+	infos := make(map[string]os.FileInfo)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			log.Printf("finding duplicates: %s", err)
+			return nil
+		}
+		if err := j.check(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() == 0 {
+			return nil
+		}
+
+		bySize[info.Size()] = append(bySize[info.Size()], path)
+		infos[path] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]string
+	for _, paths := range bySize {
+		if len(paths) > 1 {
+			groups = append(groups, paths)
+			j.addTotalCount(int64(len(paths)))
+		}
+	}
+
+	groups, err = splitGroups(groups, func(path string) (string, error) {
+		defer j.addCount(1)
+		sum, err := partialChecksum(path)
+		return string(sum), err
+	}, j)
+	if err != nil {
+		return nil, err
+	}
+
+	// files smaller than the partial size are already compared completely
+	var small, large [][]string
+	for _, group := range groups {
+		if infos[group[0]].Size() <= duplicatePartialSize {
+			small = append(small, group)
+		} else {
+			large = append(large, group)
+			j.addTotalBytes(infos[group[0]].Size() * int64(len(group)))
+		}
+	}
+
+	large, err = splitGroups(large, func(path string) (string, error) {
+		defer j.addBytes(infos[path].Size())
+		sum, err := fileChecksum(path, false)
+		return string(sum), err
+	}, j)
+	if err != nil {
+		return nil, err
+	}
+
+	// hard links are only found in the final sets, which are usually small
+	groups = nil
+	for _, group := range append(small, large...) {
+		var files []string
+	loop:
+		for _, path := range group {
+			for _, other := range files {
+				if os.SameFile(infos[path], infos[other]) {
+					continue loop
+				}
+			}
+			files = append(files, path)
+		}
+		if len(files) > 1 {
+			sort.Strings(files)
+			groups = append(groups, files)
+		}
+	}
+	sort.Slice(groups, func(i, k int) bool {
+		si, sk := infos[groups[i][0]].Size(), infos[groups[k][0]].Size()
+		if si != sk {
+			return si > sk
+		}
+		return groups[i][0] < groups[k][0]
+	})
+
+	return groups, nil
+}
+
+// duplicateNames returns the names of the files in the given duplicate sets as
+// shown in the listing, which are the paths relative to the given directory
+// prefixed by the number of the set.
+func duplicateNames(root string, groups [][]string) (paths, names []string) {
+	width := len(strconv.Itoa(len(groups)))
+	for i, group := range groups {
+		for _, path := range group {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				rel = path
+			}
+			paths = append(paths, path)
+			names = append(names, fmt.Sprintf("%0*d %s", width, i+1, rel))
+		}
+	}
+	return paths, names
+}
+
+// findDuplicatesAsync finds duplicate files in the given directory in the
+// background and changes to a listing of the duplicate sets when done.
+func (nav *nav) findDuplicatesAsync(app *app, root string) {
+	j := nav.jobs.add("find-duplicates", root)
+	defer nav.jobs.remove(j)
+
+	groups, err := findDuplicates(root, j)
+	if err == errJobCancelled {
+		app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+		return
+	}
+	if err != nil {
+		app.ui.exprChan <- &callExpr{"echoerr", []string{"find-duplicates: " + err.Error()}, 1}
+		return
+	}
+
+	if len(groups) == 0 {
+		app.ui.exprChan <- &callExpr{"echo", []string{"find-duplicates: no duplicates found"}, 1}
+		return
+	}
+
+	paths, names := duplicateNames(root, groups)
+	path := addListing(root, "duplicates", paths, names)
+
+	app.ui.exprChan <- &callExpr{"cd", []string{path}, 1}
+	app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Found %d duplicate sets with %d files", len(groups), len(paths))}, 1}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	tmp := t.TempDir()
+
+	large := bytes.Repeat([]byte("a"), duplicatePartialSize+10)
+	largeOther := append(bytes.Repeat([]byte("a"), duplicatePartialSize+9), 'b')
+
+	files := map[string][]byte{
+		"a":              []byte("foo"),
+		"dir/b":          []byte("foo"),
+		"c":              []byte("bar"),
+		"empty1":         nil,
+		"empty2":         nil,
+		"large1":         large,
+		"dir/sub/large2": large,
+		"large3":         largeOther,
+	}
+	for name, data := range files {
+		path := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(tmp, "a"), filepath.Join(tmp, "hardlink")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("c", filepath.Join(tmp, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := findDuplicates(tmp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := [][]string{
+		{filepath.Join(tmp, "dir", "sub", "large2"), filepath.Join(tmp, "large1")},
+		{filepath.Join(tmp, "a"), filepath.Join(tmp, "dir", "b")},
+	}
+	if !reflect.DeepEqual(groups, exp) {
+		t.Errorf("expected '%v' but got '%v'", exp, groups)
+	}
+
+	paths, names := duplicateNames(tmp, groups)
+	path := addListing(tmp, "duplicates", paths, names)
+
+	if err := os.Remove(filepath.Join(tmp, "large1")); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := readdir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range listed {
+		got = append(got, f.Name())
+	}
+	expNames := []string{"1 " + filepath.Join("dir", "sub", "large2"), "2 a", "2 " + filepath.Join("dir", "b")}
+	if !reflect.DeepEqual(got, expNames) {
+		t.Errorf("expected listing '%v' but got '%v'", expNames, got)
+	}
+}
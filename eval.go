@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -22,12 +23,26 @@ func (e *setExpr) eval(app *app, args []string) {
 		genOpts.anchorfind = false
 	case "anchorfind!":
 		genOpts.anchorfind = !genOpts.anchorfind
+	case "archivedirs":
+		genOpts.archivedirs = true
+	case "noarchivedirs":
+		genOpts.archivedirs = false
+	case "archivedirs!":
+		genOpts.archivedirs = !genOpts.archivedirs
 	case "autoquit":
 		genOpts.autoquit = true
 	case "noautoquit":
 		genOpts.autoquit = false
 	case "autoquit!":
 		genOpts.autoquit = !genOpts.autoquit
+	case "autodirsize":
+		genOpts.autodirsize = true
+		app.nav.autoDirSizes(app)
+	case "noautodirsize":
+		genOpts.autodirsize = false
+	case "autodirsize!":
+		genOpts.autodirsize = !genOpts.autodirsize
+		app.nav.autoDirSizes(app)
 	case "dircache":
 		genOpts.dircache = true
 	case "nodircache":
@@ -222,6 +237,30 @@ func (e *setExpr) eval(app *app, args []string) {
 			return
 		}
 		genOpts.preview = !genOpts.preview
+	case "progressbar":
+		genOpts.progressbar = true
+		app.ui.renew()
+		if app.nav.height != app.ui.wins[0].h {
+			app.nav.height = app.ui.wins[0].h
+			app.nav.regCache = make(map[string]*reg)
+		}
+		app.ui.loadFile(app, true)
+	case "noprogressbar":
+		genOpts.progressbar = false
+		app.ui.renew()
+		if app.nav.height != app.ui.wins[0].h {
+			app.nav.height = app.ui.wins[0].h
+			app.nav.regCache = make(map[string]*reg)
+		}
+		app.ui.loadFile(app, true)
+	case "progressbar!":
+		genOpts.progressbar = !genOpts.progressbar
+		app.ui.renew()
+		if app.nav.height != app.ui.wins[0].h {
+			app.nav.height = app.ui.wins[0].h
+			app.nav.regCache = make(map[string]*reg)
+		}
+		app.ui.loadFile(app, true)
 	case "relativenumber":
 		genOpts.relativenumber = true
 	case "norelativenumber":
@@ -261,8 +300,23 @@ func (e *setExpr) eval(app *app, args []string) {
 		genOpts.smartdia = false
 	case "smartdia!":
 		genOpts.smartdia = !genOpts.smartdia
+	case "verifycopy":
+		genOpts.verifycopy = true
+	case "noverifycopy":
+		genOpts.verifycopy = false
+	case "verifycopy!":
+		genOpts.verifycopy = !genOpts.verifycopy
 	case "waitmsg":
 		genOpts.waitmsg = e.val
+	case "watch":
+		genOpts.watch = true
+		app.nav.updateWatches()
+	case "nowatch":
+		genOpts.watch = false
+		app.nav.updateWatches()
+	case "watch!":
+		genOpts.watch = !genOpts.watch
+		app.nav.updateWatches()
 	case "wrapscan":
 		genOpts.wrapscan = true
 	case "nowrapscan":
@@ -286,6 +340,17 @@ func (e *setExpr) eval(app *app, args []string) {
 			return
 		}
 		genOpts.findlen = n
+	case "copyworkers":
+		n, err := strconv.Atoi(e.val)
+		if err != nil {
+			app.ui.echoerrf("copyworkers: %s", err)
+			return
+		}
+		if n <= 0 {
+			app.ui.echoerr("copyworkers: value should be a positive number")
+			return
+		}
+		genOpts.copyworkers = n
 	case "period":
 		n, err := strconv.Atoi(e.val)
 		if err != nil {
@@ -364,10 +429,30 @@ func (e *setExpr) eval(app *app, args []string) {
 			}
 		}
 		genOpts.info = toks
+		app.nav.autoDirSizes(app)
+	case "preserve":
+		if e.val == "" {
+			genOpts.preserve = nil
+			return
+		}
+		toks := strings.Split(e.val, ":")
+		for _, s := range toks {
+			switch s {
+			case "mode", "timestamps", "owner", "xattr":
+			default:
+				app.ui.echoerr("preserve: should consist of 'mode', 'timestamps', 'owner' or 'xattr' separated with colon")
+				return
+			}
+		}
+		genOpts.preserve = toks
 	case "previewer":
 		genOpts.previewer = replaceTilde(e.val)
 	case "cleaner":
 		genOpts.cleaner = replaceTilde(e.val)
+	case "clipboardcopy":
+		genOpts.clipboardcopy = e.val
+	case "clipboardpaste":
+		genOpts.clipboardpaste = e.val
 	case "promptfmt":
 		genOpts.promptfmt = e.val
 	case "ratios":
@@ -394,6 +479,20 @@ func (e *setExpr) eval(app *app, args []string) {
 		app.ui.loadFile(app, true)
 	case "selmode":
 		genOpts.selmode = e.val
+	case "deletemode":
+		if e.val != "delete" && e.val != "trash" {
+			app.ui.echoerr("deletemode: value should either be 'delete' or 'trash'")
+			return
+		}
+		genOpts.deletemode = e.val
+	case "pasteconflict":
+		switch e.val {
+		case "rename", "skip", "overwrite", "newer", "ask":
+			genOpts.pasteconflict = e.val
+		default:
+			app.ui.echoerr("pasteconflict: value should either be 'rename', 'skip', 'overwrite', 'newer' or 'ask'")
+			return
+		}
 	case "shell":
 		genOpts.shell = e.val
 	case "shellflag":
@@ -426,6 +525,7 @@ func (e *setExpr) eval(app *app, args []string) {
 		}
 		app.nav.sort()
 		app.ui.sort()
+		app.nav.autoDirSizes(app)
 	case "tempmarks":
 		if e.val != "" {
 			genOpts.tempmarks = "'" + e.val
@@ -578,7 +678,7 @@ func (e *callExpr) eval(app *app, args []string) {
 			return
 		}
 
-		if curr.IsDir() {
+		if curr.browsable() {
 			resetIncCmd(app)
 			preChdir(app)
 			err := app.nav.open()
@@ -593,6 +693,11 @@ func (e *callExpr) eval(app *app, args []string) {
 			return
 		}
 
+		if isArchivePath(curr.path) {
+			app.ui.echoerr("opening: files inside archives can only be copied out")
+			return
+		}
+
 		if genSelectionPath != "" {
 			out, err := os.Create(genSelectionPath)
 			if err != nil {
@@ -764,58 +869,40 @@ func (e *callExpr) eval(app *app, args []string) {
 		if !app.nav.init {
 			return
 		}
-		err := app.nav.calcDirSize()
-		if err != nil {
+		if err := app.nav.calcDirSize(app); err != nil {
 			app.ui.echoerrf("calcdirsize: %s", err)
-			return
 		}
-		app.ui.loadFileInfo(app.nav)
-		app.nav.sort()
-		app.ui.sort()
-	case "copy":
+	case "copy", "cut", "copy-append", "cut-append":
 		if !app.nav.init {
 			return
 		}
 
-		if err := app.nav.save(true); err != nil {
-			app.ui.echoerrf("copy: %s", err)
-			return
-		}
-		app.nav.unselect()
-		if genSingleMode {
-			if err := app.nav.sync(); err != nil {
-				app.ui.echoerrf("copy: %s", err)
-				return
-			}
-		} else {
-			if err := remote("send sync"); err != nil {
-				app.ui.echoerrf("copy: %s", err)
-				return
-			}
-		}
-		app.ui.loadFileInfo(app.nav)
-	case "cut":
-		if !app.nav.init {
+		reg, err := registerArg(e.args)
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
 			return
 		}
-
-		if err := app.nav.save(false); err != nil {
-			app.ui.echoerrf("cut: %s", err)
+		n, err := app.nav.save(reg, strings.HasPrefix(e.name, "copy"), strings.HasSuffix(e.name, "-append"))
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
 			return
 		}
 		app.nav.unselect()
 		if genSingleMode {
 			if err := app.nav.sync(); err != nil {
-				app.ui.echoerrf("cut: %s", err)
+				app.ui.echoerrf("%s: %s", e.name, err)
 				return
 			}
 		} else {
 			if err := remote("send sync"); err != nil {
-				app.ui.echoerrf("cut: %s", err)
+				app.ui.echoerrf("%s: %s", e.name, err)
 				return
 			}
 		}
 		app.ui.loadFileInfo(app.nav)
+		if reg != "" {
+			app.ui.echof("%s: %d files in register %s", e.name, n, reg)
+		}
 	case "paste":
 		if !app.nav.init {
 			return
@@ -823,12 +910,64 @@ func (e *callExpr) eval(app *app, args []string) {
 
 		if cmd, ok := genOpts.cmds["paste"]; ok {
 			cmd.eval(app, e.args)
-		} else if err := app.nav.paste(app); err != nil {
+		} else if reg, err := registerArg(e.args); err != nil {
+			app.ui.echoerrf("paste: %s", err)
+			return
+		} else if err := app.nav.paste(app, reg); err != nil {
 			app.ui.echoerrf("paste: %s", err)
 			return
 		}
 		app.ui.loadFile(app, true)
 		app.ui.loadFileInfo(app.nav)
+	case "paste-preview":
+		if !app.nav.init {
+			return
+		}
+		if app.ui.cmdPrefix == ">" {
+			return
+		}
+		reg, err := registerArg(e.args)
+		if err != nil {
+			app.ui.echoerrf("paste-preview: %s", err)
+			return
+		}
+		srcs, cp, err := loadFiles(reg)
+		if err != nil {
+			app.ui.echoerrf("paste-preview: %s", err)
+			return
+		}
+		if len(srcs) == 0 {
+			app.ui.echoerr("paste-preview: no file in copy/cut buffer")
+			return
+		}
+		dir := app.nav.fileDir()
+		items, total, err := planPaste(srcs, cp, dir)
+		if err != nil {
+			app.ui.echoerrf("paste-preview: %s", err)
+			return
+		}
+		op := "move"
+		if cp {
+			op = "copy"
+		}
+		normal(app)
+		app.nav.pasteRegister = reg
+		app.nav.pastePrompt = op + " " + strconv.Itoa(len(items)) + " files (" + humanize(total) + ")? [y/N] "
+		app.ui.menuBuf = listPasteItems(items, dir)
+		app.ui.cmdPrefix = app.nav.pastePrompt
+	case "paste-symlink", "paste-relative-symlink", "paste-hardlink":
+		if !app.nav.init {
+			return
+		}
+		reg, err := registerArg(e.args)
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+			return
+		}
+		if err := app.nav.pasteLink(app, strings.TrimPrefix(e.name, "paste-"), reg); err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+			return
+		}
 	case "delete":
 		if !app.nav.init {
 			return
@@ -848,6 +987,9 @@ func (e *callExpr) eval(app *app, args []string) {
 			}
 		} else {
 			list, err := app.nav.currFileOrSelections()
+			if err == nil {
+				err = checkArchivePaths(list)
+			}
 			if err != nil {
 				app.ui.echoerrf("delete: %s", err)
 				return
@@ -865,11 +1007,117 @@ func (e *callExpr) eval(app *app, args []string) {
 		}
 		app.ui.loadFile(app, true)
 		app.ui.loadFileInfo(app.nav)
+	case "trash":
+		if !app.nav.init {
+			return
+		}
+
+		if cmd, ok := genOpts.cmds["trash"]; ok {
+			cmd.eval(app, e.args)
+		} else if err := app.nav.del(app, true); err != nil {
+			app.ui.echoerrf("trash: %s", err)
+			return
+		}
+		app.nav.unselect()
+		if genSingleMode {
+			app.nav.renew()
+			app.ui.loadFile(app, true)
+		} else {
+			if err := remote("send load"); err != nil {
+				app.ui.echoerrf("trash: %s", err)
+				return
+			}
+		}
+		app.ui.loadFile(app, true)
+		app.ui.loadFileInfo(app.nav)
+	case "trash-restore":
+		if !app.nav.init {
+			return
+		}
+
+		if len(e.args) == 0 {
+			if app.ui.cmdPrefix == ">" {
+				return
+			}
+			dir := app.nav.fileDir()
+			items, err := listTrash(trashDirs(dir))
+			if err != nil {
+				app.ui.echoerrf("trash-restore: %s", err)
+				return
+			}
+			var local []*trashItem
+			for _, item := range items {
+				if filepath.Dir(item.path) == dir {
+					local = append(local, item)
+				}
+			}
+			if len(local) == 0 {
+				app.ui.echoerr("trash-restore: no trashed files from this directory")
+				return
+			}
+			normal(app)
+			app.ui.menuBuf = listTrashItems(local)
+			app.ui.cmdPrefix = "trash-restore: "
+			return
+		}
+
+		restoreTrash(app, e.args)
+	case "trash-empty":
+		if !app.nav.init {
+			return
+		}
+		if app.ui.cmdPrefix == ">" {
+			return
+		}
+		normal(app)
+		app.ui.cmdPrefix = "empty trash? [y/N] "
+	case "jobs":
+		if !app.nav.init {
+			return
+		}
+		jobs := app.nav.jobs.list()
+		if len(jobs) == 0 {
+			app.ui.echo("jobs: no running jobs")
+			return
+		}
+		app.ui.menuBuf = listJobs(jobs)
+	case "job-cancel", "job-pause":
+		if !app.nav.init {
+			return
+		}
+		j, err := app.nav.findJob(e.args)
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+			return
+		}
+		if e.name == "job-cancel" {
+			j.cancel()
+			app.ui.echof("Cancelling job %d", j.id)
+		} else if j.togglePause() {
+			app.ui.echof("Paused job %d", j.id)
+		} else {
+			app.ui.echof("Resumed job %d", j.id)
+		}
+	case "undo":
+		if !app.nav.init {
+			return
+		}
+		go app.nav.replay(app, true)
+	case "redo":
+		if !app.nav.init {
+			return
+		}
+		go app.nav.replay(app, false)
 	case "clear":
 		if !app.nav.init {
 			return
 		}
-		if err := saveFiles(nil, false); err != nil {
+		reg, err := registerArg(e.args)
+		if err != nil {
+			app.ui.echoerrf("clear: %s", err)
+			return
+		}
+		if err := saveFiles(reg, nil, false); err != nil {
 			app.ui.echoerrf("clear: %s", err)
 			return
 		}
@@ -885,6 +1133,53 @@ func (e *callExpr) eval(app *app, args []string) {
 			}
 		}
 		app.ui.loadFileInfo(app.nav)
+	case "yank-path", "yank-name", "yank-dir":
+		if !app.nav.init {
+			return
+		}
+		if cmd, ok := genOpts.cmds[e.name]; ok {
+			cmd.eval(app, e.args)
+			return
+		}
+		text, err := app.nav.yankText(strings.TrimPrefix(e.name, "yank-"))
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+			return
+		}
+		if err := app.setClipboard(text); err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+			return
+		}
+		app.ui.echof("%s: %d lines copied to clipboard", e.name, strings.Count(text, "\n")+1)
+	case "paste-from-clipboard":
+		if !app.nav.init {
+			return
+		}
+		reg, err := registerArg(e.args)
+		if err != nil {
+			app.ui.echoerrf("paste-from-clipboard: %s", err)
+			return
+		}
+		n, err := app.nav.pasteFromClipboard(reg)
+		if n > 0 {
+			if genSingleMode {
+				if err := app.nav.sync(); err != nil {
+					app.ui.echoerrf("paste-from-clipboard: %s", err)
+					return
+				}
+			} else {
+				if err := remote("send sync"); err != nil {
+					app.ui.echoerrf("paste-from-clipboard: %s", err)
+					return
+				}
+			}
+			app.ui.loadFileInfo(app.nav)
+		}
+		if err != nil {
+			app.ui.echoerrf("paste-from-clipboard: %s", err)
+			return
+		}
+		app.ui.echof("paste-from-clipboard: %d files to copy", n)
 	case "draw":
 	case "redraw":
 		if !app.nav.init {
@@ -1114,6 +1409,23 @@ func (e *callExpr) eval(app *app, args []string) {
 		normal(app)
 		app.ui.menuBuf = listMarks(app.nav.marks)
 		app.ui.cmdPrefix = "mark-remove: "
+	case "register":
+		if app.ui.cmdPrefix == ">" {
+			return
+		}
+		normal(app)
+		app.ui.menuBuf = listRegisters()
+		app.ui.cmdPrefix = "register: "
+	case "registers":
+		if !app.nav.init {
+			return
+		}
+		b := listRegisters()
+		if strings.Count(b.String(), "\n") < 2 {
+			app.ui.echo("registers: no files in registers")
+			return
+		}
+		app.ui.menuBuf = b
 	case "rename":
 		if !app.nav.init {
 			return
@@ -1135,14 +1447,295 @@ func (e *callExpr) eval(app *app, args []string) {
 				app.ui.echoerrf("rename: %s:", err)
 				return
 			}
+			if isArchivePath(curr.path) {
+				app.ui.echoerr("rename: archives are read-only")
+				return
+			}
 			if app.ui.cmdPrefix == ">" {
 				return
 			}
 			normal(app)
 			app.ui.cmdPrefix = "rename: "
-			app.ui.cmdAccLeft = append(app.ui.cmdAccLeft, []rune(curr.Name())...)
+			app.ui.cmdAccLeft = append(app.ui.cmdAccLeft, []rune(filepath.Base(curr.path))...)
+		}
+		app.ui.loadFile(app, true)
+		app.ui.loadFileInfo(app.nav)
+	case "rename-pattern":
+		if !app.nav.init {
+			return
+		}
+		if app.ui.cmdPrefix == ">" {
+			return
+		}
+		if len(e.args) != 2 {
+			app.ui.echoerr("rename-pattern: requires a pattern and a replacement")
+			return
+		}
+		re, err := regexp.Compile(e.args[0])
+		if err != nil {
+			app.ui.echoerrf("rename-pattern: %s", err)
+			return
+		}
+		list, err := app.nav.currFileOrSelections()
+		if err == nil {
+			err = checkArchivePaths(list)
+		}
+		if err != nil {
+			app.ui.echoerrf("rename-pattern: %s", err)
+			return
+		}
+		olds, news := patternRenames(re, e.args[1], list)
+		if len(olds) == 0 {
+			app.ui.echo("rename-pattern: nothing to rename")
+			return
+		}
+		if _, err := planRenames(olds, news, true); err != nil {
+			app.ui.echoerrf("rename-pattern: %s", err)
+			return
+		}
+		normal(app)
+		app.nav.renameOlds, app.nav.renameNews = olds, news
+		app.ui.menuBuf = listRenames(olds, news, app.nav.fileDir())
+		app.ui.cmdPrefix = "rename " + strconv.Itoa(len(olds)) + " files ? [y/N] "
+	case "mkdir", "mkdir-cd", "touch":
+		if !app.nav.init {
+			return
+		}
+		if cmd, ok := genOpts.cmds[e.name]; ok {
+			cmd.eval(app, e.args)
+			return
+		}
+		if len(e.args) == 0 {
+			app.ui.echoerrf("%s: requires a name", e.name)
+			return
+		}
+		paths, err := app.nav.makeFiles(e.args, e.name != "touch")
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+		}
+		if genSingleMode {
+			app.nav.renew()
+		} else {
+			if err := remote("send load"); err != nil {
+				app.ui.echoerrf("%s: %s", e.name, err)
+				return
+			}
+		}
+		if len(paths) == 0 {
+			return
+		}
+		last := paths[len(paths)-1]
+		if e.name == "mkdir-cd" {
+			(&callExpr{"cd", []string{last}, 1}).eval(app, nil)
+		} else {
+			(&callExpr{"select", []string{last}, 1}).eval(app, nil)
+		}
+	case "chmod", "chown":
+		if !app.nav.init {
+			return
+		}
+		if cmd, ok := genOpts.cmds[e.name]; ok {
+			cmd.eval(app, e.args)
+			return
+		}
+		args := e.args
+		recursive := len(args) > 0 && args[0] == "-R"
+		if recursive {
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			if e.name == "chmod" {
+				app.ui.echoerr("chmod: requires a mode")
+			} else {
+				app.ui.echoerr("chown: requires an owner")
+			}
+			return
+		}
+		list, err := app.nav.currFileOrSelections()
+		if err == nil {
+			err = checkArchivePaths(list)
+		}
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+			return
+		}
+		if e.name == "chmod" {
+			err = chmodPaths(list, args[0], recursive)
+		} else {
+			err = chownPaths(list, args[0], recursive)
+		}
+		if err != nil {
+			app.ui.echoerrf("%s: %s", e.name, err)
+		}
+		app.reloadInfo(e.name)
+	case "chmod-edit":
+		if !app.nav.init || app.ui.cmdPrefix == ">" {
+			return
+		}
+		normal(app)
+		if err := app.chmodEdit(); err != nil {
+			app.ui.echoerrf("chmod-edit: %s", err)
+		}
+	case "archive":
+		if !app.nav.init {
+			return
+		}
+		if cmd, ok := genOpts.cmds[e.name]; ok {
+			cmd.eval(app, e.args)
+			return
+		}
+		if len(e.args) != 1 {
+			app.ui.echoerr("archive: requires a name")
+			return
+		}
+		path := filepath.Clean(replaceTilde(e.args[0]))
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(app.nav.fileDir(), path)
+		}
+		if isArchivePath(path) || isListingPath(path) {
+			app.ui.echoerrf("archive: %s: not a real directory", filepath.Dir(path))
+			return
+		}
+		if archiveFormat(path) == "" {
+			app.ui.echoerr("archive: name should end with '.tar', '.tar.gz', '.tgz' or '.zip'")
+			return
+		}
+		if _, err := os.Lstat(path); err == nil {
+			app.ui.echoerrf("archive: %s: file exists", path)
+			return
+		}
+		list, err := app.nav.currFileOrSelections()
+		if err != nil {
+			app.ui.echoerrf("archive: %s", err)
+			return
+		}
+		go app.nav.archiveAsync(app, list, path)
+	case "extract":
+		if !app.nav.init {
+			return
+		}
+		if cmd, ok := genOpts.cmds[e.name]; ok {
+			cmd.eval(app, e.args)
+			return
+		}
+		curr, err := app.nav.currFile()
+		if err != nil {
+			app.ui.echoerrf("extract: %s", err)
+			return
+		}
+		if archiveFormat(curr.path) == "" {
+			app.ui.echoerrf("extract: %s: unsupported archive format", curr.Name())
+			return
+		}
+		dir := app.nav.fileDir()
+		if len(e.args) > 0 {
+			dir = filepath.Clean(replaceTilde(e.args[0]))
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(app.nav.fileDir(), dir)
+			}
+			if isArchivePath(dir) || isListingPath(dir) {
+				app.ui.echoerrf("extract: %s: not a real directory", dir)
+				return
+			}
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				app.ui.echoerrf("extract: %s", err)
+				return
+			}
+		}
+		go app.nav.extractAsync(app, curr.path, dir)
+	case "find-duplicates":
+		if !app.nav.init {
+			return
+		}
+		dir := workDir(app.nav.currDir().path)
+		if len(e.args) > 0 {
+			dir = filepath.Clean(replaceTilde(e.args[0]))
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(app.nav.fileDir(), dir)
+			}
+		}
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			app.ui.echoerrf("find-duplicates: %s", err)
+			return
+		}
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			app.ui.echoerrf("find-duplicates: %s: not a directory", dir)
+			return
+		}
+		go app.nav.findDuplicatesAsync(app, root)
+	case "flatten":
+		if !app.nav.init {
+			return
+		}
+		depth := 0
+		if len(e.args) > 0 {
+			n, err := strconv.Atoi(e.args[0])
+			if err != nil || n < 1 {
+				app.ui.echoerr("flatten: depth should be a positive number")
+				return
+			}
+			depth = n
+		}
+		dir := app.nav.currDir().path
+		if isArchivePath(dir) {
+			app.ui.echoerr("flatten: directories inside archives cannot be flattened")
+			return
+		}
+		path := addFlatListing(workDir(dir), depth)
+		delete(app.nav.dirCache, path)
+		(&callExpr{"cd", []string{path}, 1}).eval(app, nil)
+	case "du":
+		if !app.nav.init {
+			return
+		}
+		dir := workDir(app.nav.currDir().path)
+		if len(e.args) > 0 {
+			dir = filepath.Clean(replaceTilde(e.args[0]))
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(app.nav.fileDir(), dir)
+			}
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			app.ui.echoerrf("du: %s: not a directory", dir)
+			return
 		}
+		app.nav.duStart(app, dir)
+		app.nav.sort()
+		app.ui.sort()
 		app.ui.loadFile(app, true)
+	case "du-exit":
+		if !app.nav.init {
+			return
+		}
+		if app.nav.duStop() {
+			app.nav.sort()
+			app.ui.sort()
+			app.ui.loadFile(app, true)
+		}
+	case "bulk-rename":
+		if !app.nav.init {
+			return
+		}
+		if cmd, ok := genOpts.cmds[e.name]; ok {
+			cmd.eval(app, e.args)
+			return
+		}
+		if app.ui.cmdPrefix == ">" {
+			return
+		}
+		if err := app.bulkRename(); err != nil {
+			app.ui.echoerrf("bulk-rename: %s", err)
+		}
+		if genSingleMode {
+			app.nav.renew()
+			app.ui.loadFile(app, true)
+		} else {
+			if err := remote("send load"); err != nil {
+				app.ui.echoerrf("bulk-rename: %s", err)
+				return
+			}
+		}
 		app.ui.loadFileInfo(app.nav)
 	case "sync":
 		if err := app.nav.sync(); err != nil {
@@ -1254,6 +1847,51 @@ func (e *callExpr) eval(app *app, args []string) {
 			app.ui.echoerrf("%s", err)
 			return
 		}
+	case "selection-save":
+		if !app.nav.init {
+			return
+		}
+		if len(e.args) != 1 {
+			app.ui.echoerr("selection-save: requires a name")
+			return
+		}
+		n, err := app.nav.saveSelections(e.args[0])
+		if err != nil {
+			app.ui.echoerrf("selection-save: %s", err)
+			return
+		}
+		app.ui.echof("selection-save: %d files saved to %s", n, e.args[0])
+	case "selection-load":
+		if !app.nav.init {
+			return
+		}
+		if len(e.args) != 1 {
+			app.ui.echoerr("selection-load: requires a name")
+			return
+		}
+		missing, err := app.nav.loadSelections(e.args[0])
+		if err != nil {
+			app.ui.echoerrf("selection-load: %s", err)
+			return
+		}
+		app.ui.loadFileInfo(app.nav)
+		if len(missing) > 0 {
+			app.ui.echoerrf("selection-load: dropped %d files that no longer exist: %s", len(missing), strings.Join(missing, " "))
+		}
+	case "selection-list":
+		if !app.nav.init {
+			return
+		}
+		names, err := selectionSetNames()
+		if err != nil {
+			app.ui.echoerrf("selection-list: %s", err)
+			return
+		}
+		if len(names) == 0 {
+			app.ui.echo("selection-list: no saved selection sets")
+			return
+		}
+		app.ui.menuBuf = listSelectionSets(names)
 	case "source":
 		if len(e.args) != 1 {
 			app.ui.echoerr("source: requires an argument")
@@ -1291,6 +1929,15 @@ func (e *callExpr) eval(app *app, args []string) {
 		app.ui.menuBuf = nil
 		app.menuCompActive = false
 	case "cmd-enter":
+		if strings.HasPrefix(app.ui.cmdPrefix, "chmod-edit") {
+			normal(app)
+			if err := os.Chmod(app.nav.chmodPath, app.nav.chmodMode&(os.ModePerm|modeSpecial)); err != nil {
+				app.ui.echoerrf("chmod-edit: %s", err)
+			}
+			app.reloadInfo("chmod-edit")
+			return
+		}
+
 		s := string(append(app.ui.cmdAccLeft, app.ui.cmdAccRight...))
 		if len(s) == 0 && app.ui.cmdPrefix != "filter: " {
 			return
@@ -1394,6 +2041,7 @@ func (e *callExpr) eval(app *app, args []string) {
 			}
 		case "rename: ":
 			app.ui.cmdPrefix = ""
+			app.nav.renameOlds, app.nav.renameNews = nil, nil
 			if curr, err := app.nav.currFile(); err != nil {
 				app.ui.echoerrf("rename: %s", err)
 			} else {
@@ -1403,7 +2051,13 @@ func (e *callExpr) eval(app *app, args []string) {
 					return
 				}
 
+				// files in listings are shown with other names in other
+				// directories
 				oldPath := filepath.Join(wd, curr.Name())
+				if _, ok := getListing(app.nav.currDir().path); ok {
+					oldPath = curr.path
+					wd = filepath.Dir(curr.path)
+				}
 
 				newPath := filepath.Clean(replaceTilde(s))
 				if !filepath.IsAbs(newPath) {
@@ -1452,6 +2106,15 @@ func (e *callExpr) eval(app *app, args []string) {
 				app.ui.loadFile(app, true)
 				app.ui.loadFileInfo(app.nav)
 			}
+		case "trash-restore: ":
+			app.ui.cmdPrefix = ""
+			restoreTrash(app, []string{s})
+		case "chown: ":
+			app.ui.cmdPrefix = ""
+			if err := chownPaths([]string{app.nav.chmodPath}, s, false); err != nil {
+				app.ui.echoerrf("chown: %s", err)
+			}
+			app.reloadInfo("chown")
 		default:
 			golog.Info("entering unknown execution prefix: %q", app.ui.cmdPrefix)
 		}
@@ -1719,6 +2382,7 @@ func preChdir(app *app) {
 
 func onChdir(app *app) {
 	app.nav.addJumpList()
+	app.nav.autoDirSizes(app)
 	if cmd, ok := genOpts.cmds["on-cd"]; ok {
 		cmd.eval(app, nil)
 	}
@@ -1878,9 +2542,31 @@ func resetIncCmd(app *app) {
 	}
 }
 
+func restoreTrash(app *app, paths []string) {
+	if err := trashRestore(app.nav.fileDir(), paths); err != nil {
+		app.ui.echoerrf("trash-restore: %s", err)
+	}
+	if genSingleMode {
+		app.nav.renew()
+		app.ui.loadFile(app, true)
+	} else {
+		if err := remote("send load"); err != nil {
+			app.ui.echoerrf("trash-restore: %s", err)
+			return
+		}
+	}
+	app.ui.loadFile(app, true)
+	app.ui.loadFileInfo(app.nav)
+}
+
 func normal(app *app) {
 	resetIncCmd(app)
 
+	if app.nav.conflictPending {
+		app.nav.conflictPending = false
+		app.nav.conflictAnswer <- "n"
+	}
+
 	app.cmdHistoryInd = 0
 	app.menuCompActive = false
 
@@ -1960,7 +2646,7 @@ func insert(app *app, arg string) {
 		normal(app)
 
 		if arg == "y" {
-			if err := app.nav.del(app); err != nil {
+			if err := app.nav.del(app, genOpts.deletemode == "trash"); err != nil {
 				app.ui.echoerrf("delete: %s", err)
 				return
 			}
@@ -1977,9 +2663,57 @@ func insert(app *app, arg string) {
 			app.ui.loadFile(app, true)
 			app.ui.loadFileInfo(app.nav)
 		}
+	case strings.HasPrefix(app.ui.cmdPrefix, "overwrite"):
+		app.nav.conflictPending = false
+		normal(app)
+
+		app.nav.conflictAnswer <- arg
+	case app.nav.pastePrompt != "" && app.ui.cmdPrefix == app.nav.pastePrompt:
+		app.nav.pastePrompt = ""
+		normal(app)
+
+		if arg == "y" {
+			if err := app.nav.paste(app, app.nav.pasteRegister); err != nil {
+				app.ui.echoerrf("paste: %s", err)
+				return
+			}
+			app.ui.loadFile(app, true)
+			app.ui.loadFileInfo(app.nav)
+		}
+	case strings.HasPrefix(app.ui.cmdPrefix, "empty trash"):
+		normal(app)
+
+		if arg == "y" {
+			dirs := trashDirs(app.nav.fileDir())
+			go func() {
+				for _, t := range dirs {
+					if err := t.empty(); err != nil {
+						app.ui.exprChan <- &callExpr{"echoerr", []string{"trash-empty: " + err.Error()}, 1}
+						return
+					}
+				}
+				app.ui.exprChan <- &callExpr{"echo", []string{"trash emptied"}, 1}
+			}()
+		}
+	case strings.HasPrefix(app.ui.cmdPrefix, "rename "):
+		normal(app)
+
+		if arg == "y" {
+			app.renamePatternCheck()
+		} else {
+			app.nav.renameOlds, app.nav.renameNews = nil, nil
+		}
 	case strings.HasPrefix(app.ui.cmdPrefix, "replace"):
 		normal(app)
 
+		if app.nav.renameNews != nil {
+			if arg == "y" {
+				app.renamePatternApply()
+			}
+			app.nav.renameOlds, app.nav.renameNews = nil, nil
+			return
+		}
+
 		if arg == "y" {
 			if err := app.nav.rename(); err != nil {
 				app.ui.echoerrf("rename: %s", err)
@@ -2000,6 +2734,22 @@ func insert(app *app, arg string) {
 	case strings.HasPrefix(app.ui.cmdPrefix, "create"):
 		normal(app)
 
+		if app.nav.renameNews != nil {
+			if arg != "y" {
+				app.nav.renameOlds, app.nav.renameNews = nil, nil
+				return
+			}
+			for _, path := range app.nav.renameNews {
+				if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+					app.ui.echoerrf("rename-pattern: %s", err)
+					app.nav.renameOlds, app.nav.renameNews = nil, nil
+					return
+				}
+			}
+			app.renamePatternCheck()
+			return
+		}
+
 		if arg == "y" {
 			if err := os.MkdirAll(filepath.Dir(app.nav.renameNewPath), os.ModePerm); err != nil {
 				app.ui.echoerrf("rename: %s", err)
@@ -2087,6 +2837,17 @@ func insert(app *app, arg string) {
 				app.ui.echoerrf("mark-remove: %s", err)
 			}
 		}
+	case app.ui.cmdPrefix == "register: ":
+		normal(app)
+		if _, err := registerArg([]string{arg}); err != nil {
+			app.ui.echoerrf("register: %s", err)
+			return
+		}
+		app.ui.register = arg
+	case app.ui.cmdPrefix == "trash-restore: ":
+		app.ui.cmdAccLeft = append(app.ui.cmdAccLeft, []rune(arg)...)
+	case strings.HasPrefix(app.ui.cmdPrefix, "chmod-edit"):
+		app.chmodEditKey(arg)
 	case app.ui.cmdPrefix == ":" && len(app.ui.cmdAccLeft) == 0:
 		switch arg {
 		case "!", "$", "%", "&":
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errJobCancelled = errors.New("cancelled")
+
+const (
+	jobSpeedInterval = time.Second // interval over which the speed of jobs is measured
+	jobNameWidth     = 20          // maximum width of file names shown in the progress
+)
+
+// job is a file operation running in the background. Progress is tracked both
+// in bytes and in number of items depending on the kind of the operation.
+// Methods of job can be called on a nil job, which can never be paused or
+// cancelled.
+type job struct {
+	id         int
+	kind       string // copy, move, link, archive, extract, find-duplicates, du, calcdirsize, delete, trash, undo or redo
+	path       string // directory or file the operation is performed on
+	start      time.Time
+	bytes      int64
+	totalBytes int64
+	count      int64
+	totalCount int64
+	mutex      sync.Mutex
+	cond       *sync.Cond
+	paused     bool
+	cancelled  bool
+	file       atomic.Pointer[string] // file currently being processed
+	speedTime  time.Time
+	speedDone  int64
+	speed      float64
+	speedKnown bool
+}
+
+type jobList struct {
+	mutex  sync.Mutex
+	jobs   map[int]*job
+	nextID int
+}
+
+func newJobList() *jobList {
+	return &jobList{
+		jobs:   make(map[int]*job),
+		nextID: 1,
+	}
+}
+
+func (l *jobList) add(kind, path string) *job {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	j := &job{
+		id:    l.nextID,
+		kind:  kind,
+		path:  path,
+		start: time.Now(),
+	}
+	j.cond = sync.NewCond(&j.mutex)
+
+	l.jobs[j.id] = j
+	l.nextID++
+
+	return j
+}
+
+func (l *jobList) remove(j *job) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.jobs, j.id)
+}
+
+func (l *jobList) get(id int) (*job, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	j, ok := l.jobs[id]
+	return j, ok
+}
+
+// list returns the running jobs sorted by their ids.
+func (l *jobList) list() []*job {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	jobs := make([]*job, 0, len(l.jobs))
+	for _, j := range l.jobs {
+		jobs = append(jobs, j)
+	}
+
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].id < jobs[k].id })
+
+	return jobs
+}
+
+// find returns the oldest running job for which the given function returns
+// true, or nil if there is no such job.
+func (l *jobList) find(match func(j *job) bool) *job {
+	for _, j := range l.list() {
+		if match(j) {
+			return j
+		}
+	}
+	return nil
+}
+
+// findJob returns the job with the id given in the arguments, or the only
+// running job when no argument is given.
+func (nav *nav) findJob(args []string) (*job, error) {
+	if len(args) == 0 {
+		jobs := nav.jobs.list()
+		if len(jobs) != 1 {
+			return nil, errors.New("requires a job id")
+		}
+		return jobs[0], nil
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid job id: %s", args[0])
+	}
+
+	j, ok := nav.jobs.get(id)
+	if !ok {
+		return nil, fmt.Errorf("no running job with id %d", id)
+	}
+
+	return j, nil
+}
+
+func (j *job) addBytes(n int64) {
+	if j != nil {
+		atomic.AddInt64(&j.bytes, n)
+	}
+}
+
+func (j *job) addTotalBytes(n int64) {
+	if j != nil {
+		atomic.AddInt64(&j.totalBytes, n)
+	}
+}
+
+func (j *job) addCount(n int64) {
+	if j != nil {
+		atomic.AddInt64(&j.count, n)
+	}
+}
+
+func (j *job) addTotalCount(n int64) {
+	if j != nil {
+		atomic.AddInt64(&j.totalCount, n)
+	}
+}
+
+// progress returns the number of processed and total bytes and items.
+func (j *job) progress() (bytes, totalBytes, count, totalCount int64) {
+	return atomic.LoadInt64(&j.bytes), atomic.LoadInt64(&j.totalBytes),
+		atomic.LoadInt64(&j.count), atomic.LoadInt64(&j.totalCount)
+}
+
+// setFile sets the file currently being processed by the job.
+func (j *job) setFile(path string) {
+	if j != nil {
+		j.file.Store(&path)
+	}
+}
+
+// currentFile returns the file currently being processed by the job, or an
+// empty string if the job does not report files.
+func (j *job) currentFile() string {
+	if p := j.file.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// done returns the number of processed and total bytes if the job tracks
+// bytes, and the number of processed and total items otherwise.
+func (j *job) done() (done, total int64, isBytes bool) {
+	bytes, totalBytes, count, totalCount := j.progress()
+	if totalBytes > 0 {
+		return bytes, totalBytes, true
+	}
+	return count, totalCount, false
+}
+
+// rate returns the number of bytes or items processed per second measured over
+// the last interval, so that a stalled job drops to zero, along with the
+// estimated remaining time. The last result is returned until the next
+// interval passes, and the average since the start is used before the first
+// interval passes.
+func (j *job) rate() (speed float64, eta time.Duration, ok bool) {
+	done, total, _ := j.done()
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	now := time.Now()
+	if j.speedTime.IsZero() {
+		j.speedTime = j.start
+	}
+
+	if elapsed := now.Sub(j.speedTime); elapsed >= jobSpeedInterval {
+		j.speed = float64(done-j.speedDone) / elapsed.Seconds()
+		j.speedTime, j.speedDone, j.speedKnown = now, done, true
+	} else if !j.speedKnown && now.Sub(j.start) > 0 {
+		j.speed = float64(done) / now.Sub(j.start).Seconds()
+	}
+
+	if j.speed <= 0 || total <= 0 || done > total {
+		return j.speed, 0, false
+	}
+
+	return j.speed, time.Duration(float64(total-done) / j.speed * float64(time.Second)), true
+}
+
+// check blocks while the job is paused and returns an error if the job is
+// cancelled. It should be called by operations between their steps.
+func (j *job) check() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for j.paused && !j.cancelled {
+		j.cond.Wait()
+	}
+
+	if j.cancelled {
+		return errJobCancelled
+	}
+
+	return nil
+}
+
+func (j *job) isCancelled() bool {
+	if j == nil {
+		return false
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.cancelled
+}
+
+func (j *job) isPaused() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.paused
+}
+
+func (j *job) cancel() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.cancelled = true
+	j.cond.Broadcast()
+}
+
+// togglePause pauses a running job or resumes a paused job and returns the new
+// state of the job.
+func (j *job) togglePause() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.paused = !j.paused
+	j.cond.Broadcast()
+
+	return j.paused
+}
+
+// hasProgress reports whether the job has a known total amount of work.
+func (j *job) hasProgress() bool {
+	_, total, _ := j.done()
+	return total > 0
+}
+
+// formatETA formats the remaining time of a job as minutes and seconds, with
+// hours when needed.
+func formatETA(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// details returns the name of the current file, the speed and the remaining
+// time of the job as shown in the ruler and the progress bar.
+func (j *job) details() string {
+	var parts []string
+
+	if path := j.currentFile(); path != "" {
+		name := []rune(filepath.Base(path))
+		if runeSliceWidth(name) > jobNameWidth {
+			name = append(runeSliceWidthRange(name, 0, jobNameWidth-1), []rune(genOpts.truncatechar)...)
+		}
+		parts = append(parts, string(name))
+	}
+
+	_, _, isBytes := j.done()
+	speed, eta, ok := j.rate()
+	if isBytes {
+		parts = append(parts, humanize(int64(speed))+"/s")
+	} else {
+		parts = append(parts, fmt.Sprintf("%.1f/s", speed))
+	}
+	if ok {
+		parts = append(parts, formatETA(eta))
+	} else {
+		parts = append(parts, "--:--")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// exportProgress exports the progress of the oldest running job with a known
+// total as environment variables, which are empty when there is no such job.
+func (nav *nav) exportProgress() {
+	vars := map[string]string{
+		"kind":    "",
+		"file":    "",
+		"unit":    "",
+		"done":    "",
+		"total":   "",
+		"percent": "",
+		"speed":   "",
+		"eta":     "",
+	}
+
+	if j := nav.jobs.find((*job).hasProgress); j != nil {
+		done, total, isBytes := j.done()
+		speed, eta, ok := j.rate()
+
+		vars["kind"] = j.kind
+		vars["file"] = j.currentFile()
+		vars["unit"] = "items"
+		if isBytes {
+			vars["unit"] = "bytes"
+		}
+		vars["done"] = strconv.FormatInt(done, 10)
+		vars["total"] = strconv.FormatInt(total, 10)
+		vars["percent"] = strconv.FormatInt(100*done/total, 10)
+		vars["speed"] = strconv.FormatInt(int64(speed), 10)
+		if ok {
+			vars["eta"] = strconv.FormatInt(int64(eta.Round(time.Second)/time.Second), 10)
+		}
+	}
+
+	os.Setenv("fm_progress_jobs", strconv.Itoa(len(nav.jobs.list())))
+	for name, value := range vars {
+		os.Setenv("fm_progress_"+name, value)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatETA(t *testing.T) {
+	tests := []struct {
+		d   time.Duration
+		exp string
+	}{
+		{0, "0:00"},
+		{42 * time.Second, "0:42"},
+		{61*time.Second + 400*time.Millisecond, "1:01"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+	}
+
+	for _, test := range tests {
+		if got := formatETA(test.d); got != test.exp {
+			t.Errorf("at input '%v' expected '%s' but got '%s'", test.d, test.exp, got)
+		}
+	}
+}
+
+func TestJobRate(t *testing.T) {
+	j := newJobList().add("copy", "/")
+	j.start = time.Now().Add(-2 * time.Second)
+	j.addTotalBytes(1000)
+	j.addBytes(200)
+
+	speed, eta, ok := j.rate()
+	if speed < 90 || speed > 110 {
+		t.Errorf("expected speed around '100' but got '%f'", speed)
+	}
+	if !ok || eta < 7*time.Second || eta > 9*time.Second {
+		t.Errorf("expected remaining time around '8s' but got '%v'", eta)
+	}
+
+	// no progress during the next interval means the job is stalled
+	j.speedTime = time.Now().Add(-jobSpeedInterval)
+	if speed, _, ok := j.rate(); speed != 0 || ok {
+		t.Errorf("expected stalled job but got speed '%f'", speed)
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// journalSize is the maximum number of operations kept in the journal.
+const journalSize = 100
+
+var (
+	// journalMutex serializes access to the journal file between file
+	// operations running in the background.
+	journalMutex sync.Mutex
+
+	// replayMutex prevents running multiple undo and redo operations at once.
+	replayMutex sync.Mutex
+)
+
+// journalItem is a single file affected by a journaled operation. The recorded
+// attributes belong to the file at its current location, which is the
+// destination after the operation and the source after it is undone.
+type journalItem struct {
+	Src     string         `json:"src"`
+	Dst     string         `json:"dst"`
+	Dir     bool           `json:"dir"`
+	Size    int64          `json:"size"`
+	ModTime time.Time      `json:"modtime"`
+	Files   []*journalFile `json:"files,omitempty"`
+}
+
+// journalFile is a file inside a copied directory. Files inside copied
+// directories are recorded as well since undoing a copy removes the whole
+// directory, and changing a file does not change the directory itself.
+type journalFile struct {
+	Path    string    `json:"path"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modtime"`
+}
+
+// journalEntry is a single journaled file operation. Supported operations are
+// 'copy', 'move', 'rename', 'trash', and links created with 'symlink',
+// 'relative-symlink' and 'hardlink'. Undone entries are kept at the end of
+// the journal to be redone and they are dropped when a new entry is recorded.
+type journalEntry struct {
+	Op     string         `json:"op"`
+	Time   time.Time      `json:"time"`
+	Items  []*journalItem `json:"items"`
+	Undone bool           `json:"undone,omitempty"`
+}
+
+func (item *journalItem) record(path string) error {
+	lstat, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	item.Dir = lstat.IsDir()
+	item.Size = lstat.Size()
+	item.ModTime = lstat.ModTime()
+
+	return nil
+}
+
+// check returns an error if the file at the given path does not match the
+// recorded attributes.
+func (item *journalItem) check(path string) error {
+	lstat, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s: file does not exist", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if lstat.IsDir() != item.Dir || !lstat.ModTime().Equal(item.ModTime) || (!item.Dir && lstat.Size() != item.Size) {
+		return fmt.Errorf("%s: file changed since the operation", path)
+	}
+
+	return nil
+}
+
+// recordFiles records the files inside the directory at the given path.
+func (item *journalItem) recordFiles(path string) error {
+	item.Files = nil
+	if !item.Dir {
+		return nil
+	}
+
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path {
+			return nil
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		item.Files = append(item.Files, &journalFile{rel, info.IsDir(), info.Size(), info.ModTime()})
+		return nil
+	})
+}
+
+// checkFiles returns an error if the files inside the directory at the given
+// path do not match the recorded files.
+func (item *journalItem) checkFiles(path string) error {
+	if len(item.Files) == 0 {
+		return nil
+	}
+
+	recorded := make(map[string]*journalFile, len(item.Files))
+	for _, f := range item.Files {
+		recorded[f.Path] = f
+	}
+
+	n := 0
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path {
+			return nil
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		f, ok := recorded[rel]
+		if !ok || info.IsDir() != f.Dir || !info.ModTime().Equal(f.ModTime) || (!f.Dir && info.Size() != f.Size) {
+			return fmt.Errorf("%s: file changed since the operation", p)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if n != len(item.Files) {
+		return fmt.Errorf("%s: file changed since the operation", path)
+	}
+
+	return nil
+}
+
+func isLinkOp(op string) bool {
+	return op == "symlink" || op == "relative-symlink" || op == "hardlink"
+}
+
+func checkAbsent(path string) error {
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		return fmt.Errorf("%s: file exists", path)
+	}
+	return nil
+}
+
+func (e *journalEntry) String() string {
+	if len(e.Items) == 1 {
+		return fmt.Sprintf("%s '%s'", e.Op, filepath.Base(e.Items[0].Src))
+	}
+	return fmt.Sprintf("%s %d files", e.Op, len(e.Items))
+}
+
+func readJournal() ([]*journalEntry, error) {
+	f, err := os.Open(genJournalPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*journalEntry
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 64*1024*1024)
+	for s.Scan() {
+		e := &journalEntry{}
+		if err := json.Unmarshal(s.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("parsing journal: %s", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, s.Err()
+}
+
+func writeJournal(entries []*journalEntry) error {
+	if len(entries) > journalSize {
+		entries = entries[len(entries)-journalSize:]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(genJournalPath), os.ModePerm); err != nil {
+		return fmt.Errorf("creating data directory: %s", err)
+	}
+
+	f, err := os.Create(genJournalPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return f.Sync()
+}
+
+// journalRecord appends an operation moving or copying the given sources to
+// the given destinations to the journal. Destinations that do not exist are
+// skipped, so that only the files actually created by the operation are
+// journaled.
+func journalRecord(op string, srcs, dsts []string) error {
+	e := &journalEntry{Op: op, Time: time.Now()}
+	for i, src := range srcs {
+		item := &journalItem{Src: src, Dst: dsts[i]}
+		if err := item.record(item.Dst); err != nil {
+			continue
+		}
+		if op == "copy" {
+			if err := item.recordFiles(item.Dst); err != nil {
+				continue
+			}
+		}
+		e.Items = append(e.Items, item)
+	}
+
+	if len(e.Items) == 0 {
+		return nil
+	}
+
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	entries, err := readJournal()
+	if err != nil {
+		return err
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !entry.Undone {
+			kept = append(kept, entry)
+		}
+	}
+
+	return writeJournal(append(kept, e))
+}
+
+// journalUpdate replaces the entry recorded at the same time with the given one.
+// The journal is read again since new entries may have been recorded meanwhile.
+func journalUpdate(e *journalEntry) error {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	entries, err := readJournal()
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		if entry.Time.Equal(e.Time) && entry.Op == e.Op {
+			entries[i] = e
+			return writeJournal(entries)
+		}
+	}
+
+	return nil
+}
+
+// check returns an error if the filesystem does not match the recorded state
+// so that undoing or redoing the entry could lose data.
+func (e *journalEntry) check(undo bool) error {
+	// renamed files may take the names of each other as in bulk renames
+	froms := make(map[string]bool)
+	if e.Op == "rename" {
+		for _, item := range e.Items {
+			if undo {
+				froms[item.Dst] = true
+			} else {
+				froms[item.Src] = true
+			}
+		}
+	}
+
+	for _, item := range e.Items {
+		switch {
+		case e.Op == "copy" && undo:
+			if err := item.check(item.Dst); err != nil {
+				return err
+			}
+			if err := item.checkFiles(item.Dst); err != nil {
+				return err
+			}
+		case isLinkOp(e.Op) && undo:
+			if err := item.check(item.Dst); err != nil {
+				return err
+			}
+		case e.Op == "copy" || isLinkOp(e.Op):
+			if _, err := os.Lstat(item.Src); err != nil {
+				return err
+			}
+			if err := checkAbsent(item.Dst); err != nil {
+				return err
+			}
+		case e.Op == "trash" && !undo:
+			if err := item.check(item.Src); err != nil {
+				return err
+			}
+		default:
+			from, to := item.Src, item.Dst
+			if undo {
+				from, to = to, from
+			}
+			if err := item.check(from); err != nil {
+				return err
+			}
+			if froms[to] {
+				continue
+			}
+			if err := checkAbsent(to); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply undoes or redoes the entry and records the new state of the files. It
+// returns the updated error count and the number of processed items, which is
+// less than the number of items when the job is cancelled.
+func (e *journalEntry) apply(app *app, j *job, undo bool, echo *callExpr, errCount int) (int, int) {
+	nav := app.nav
+
+	fail := func(err error) {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+		app.ui.exprChan <- echo
+	}
+
+	if e.Op == "copy" && !undo {
+		var srcs, dsts []string
+		for _, item := range e.Items {
+			srcs = append(srcs, item.Src)
+			dsts = append(dsts, item.Dst)
+		}
+		errCount = nav.copyWait(app, j, srcs, dsts, nil, echo, errCount)
+		if j.isCancelled() {
+			// destinations are checked to be absent before so they can be removed
+			for _, item := range e.Items {
+				os.RemoveAll(item.Dst)
+			}
+			return errCount, 0
+		}
+		for _, item := range e.Items {
+			item.record(item.Dst)
+			item.recordFiles(item.Dst)
+		}
+		return errCount, len(e.Items)
+	}
+
+	if e.Op == "rename" {
+		// renames are applied at once since they may depend on each other
+		var froms, tos []string
+		for _, item := range e.Items {
+			from, to := item.Src, item.Dst
+			if undo {
+				from, to = to, from
+			}
+			froms = append(froms, from)
+			tos = append(tos, to)
+		}
+		ops, err := planRenames(froms, tos, false)
+		if err == nil {
+			err = applyRenames(ops)
+		}
+		if err != nil {
+			fail(err)
+			return errCount, 0
+		}
+		for i, item := range e.Items {
+			item.record(tos[i])
+		}
+		return errCount, len(e.Items)
+	}
+
+	nav.moveTotalChan <- len(e.Items)
+	j.addTotalCount(int64(len(e.Items)))
+
+	n := 0
+	for _, item := range e.Items {
+		if j.check() != nil {
+			break
+		}
+
+		nav.moveCountChan <- 1
+		j.addCount(1)
+		j.setFile(item.Src)
+
+		switch {
+		case e.Op == "copy":
+			if err := os.RemoveAll(item.Dst); err != nil {
+				fail(err)
+			}
+		case isLinkOp(e.Op) && undo:
+			if err := os.Remove(item.Dst); err != nil {
+				fail(err)
+			}
+		case isLinkOp(e.Op):
+			if err := linkFile(e.Op, item.Src, item.Dst); err != nil {
+				fail(err)
+			} else {
+				item.record(item.Dst)
+			}
+		case e.Op == "trash" && undo:
+			t := &trashDir{path: filepath.Dir(filepath.Dir(item.Dst))}
+			restored := &trashItem{dir: t, name: filepath.Base(item.Dst), path: item.Src}
+			if err := restored.restore(); err != nil {
+				fail(err)
+			} else {
+				item.record(item.Src)
+			}
+		case e.Op == "trash":
+			if dst, err := trash(item.Src); err != nil {
+				fail(err)
+			} else {
+				item.Dst = dst
+				item.record(item.Dst)
+			}
+		default:
+			from, to := item.Src, item.Dst
+			if undo {
+				from, to = to, from
+			}
+			errCount = nav.moveFile(app, j, from, to, echo, errCount)
+			if !j.isCancelled() {
+				item.record(to)
+			}
+		}
+
+		if j.isCancelled() {
+			break
+		}
+		n++
+	}
+
+	// count skipped items of cancelled jobs so the ruler is reset properly
+	if _, _, count, _ := j.progress(); count < int64(len(e.Items)) {
+		nav.moveCountChan <- len(e.Items) - int(count)
+	}
+	nav.moveTotalChan <- -len(e.Items)
+
+	return errCount, n
+}
+
+// replay undoes the last journaled operation or redoes the last undone one.
+func (nav *nav) replay(app *app, undo bool) {
+	name := "redo"
+	if undo {
+		name = "undo"
+	}
+
+	echo := &callExpr{"echoerr", []string{""}, 1}
+
+	if !replayMutex.TryLock() {
+		echo.args[0] = fmt.Sprintf("%s: another undo or redo is in progress", name)
+		app.ui.exprChan <- echo
+		return
+	}
+	defer replayMutex.Unlock()
+
+	journalMutex.Lock()
+	entries, err := readJournal()
+	journalMutex.Unlock()
+	if err != nil {
+		echo.args[0] = fmt.Sprintf("%s: %s", name, err)
+		app.ui.exprChan <- echo
+		return
+	}
+
+	var e *journalEntry
+	if undo {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !entries[i].Undone {
+				e = entries[i]
+				break
+			}
+		}
+	} else {
+		for _, entry := range entries {
+			if entry.Undone {
+				e = entry
+				break
+			}
+		}
+	}
+
+	if e == nil {
+		echo.args[0] = fmt.Sprintf("%s: nothing to %s", name, name)
+		app.ui.exprChan <- echo
+		return
+	}
+
+	if err := e.check(undo); err != nil {
+		echo.args[0] = fmt.Sprintf("%s: %s: %s", name, e, err)
+		app.ui.exprChan <- echo
+		return
+	}
+
+	j := nav.jobs.add(name, filepath.Dir(e.Items[0].Src))
+	defer nav.jobs.remove(j)
+
+	errCount, n := e.apply(app, j, undo, echo, 0)
+
+	if n < len(e.Items) {
+		// processed files of cancelled jobs can not be undone or redone anymore
+		e.Items = e.Items[n:]
+	} else {
+		e.Undone = undo
+	}
+	if err := journalUpdate(e); err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] journal: %s", errCount, err)
+		app.ui.exprChan <- echo
+	}
+
+	if genSingleMode {
+		nav.renew()
+		app.ui.loadFile(app, true)
+	} else {
+		if err := remote("send load"); err != nil {
+			errCount++
+			echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+			app.ui.exprChan <- echo
+		}
+	}
+
+	if j.isCancelled() {
+		app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+	} else if errCount == 0 {
+		msg := "Redone: " + e.String()
+		if undo {
+			msg = "Undone: " + e.String()
+		}
+		app.ui.exprChan <- &callExpr{"echo", []string{msg}, 1}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalRecord(t *testing.T) {
+	tmp := t.TempDir()
+
+	defer func(path string) { genJournalPath = path }(genJournalPath)
+	genJournalPath = filepath.Join(tmp, "fm", "journal")
+
+	src := filepath.Join(tmp, "foo")
+	dst := filepath.Join(tmp, "bar")
+	if err := os.WriteFile(dst, []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := journalRecord("rename", []string{src}, []string{dst}); err != nil {
+		t.Fatal(err)
+	}
+	if err := journalRecord("copy", []string{src}, []string{filepath.Join(tmp, "baz")}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry but got %d", len(entries))
+	}
+
+	e := entries[0]
+	if e.Op != "rename" || len(e.Items) != 1 || e.Items[0].Src != src || e.Items[0].Dst != dst {
+		t.Fatalf("unexpected entry '%+v'", e)
+	}
+
+	if err := e.check(true); err != nil {
+		t.Errorf("undo check should pass but got '%s'", err)
+	}
+	if err := e.check(false); err == nil {
+		t.Errorf("redo check should fail for missing source")
+	}
+
+	if err := os.WriteFile(dst, []byte("foobar"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.check(true); err == nil {
+		t.Errorf("undo check should fail for modified file")
+	}
+
+	e.Undone = true
+	if err := journalUpdate(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := journalRecord("trash", []string{src}, []string{dst}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Op != "trash" {
+		t.Errorf("undone entries should be dropped when recording but got '%d' entries", len(entries))
+	}
+}
+
+func TestJournalCheckLink(t *testing.T) {
+	tmp := t.TempDir()
+
+	src := filepath.Join(tmp, "foo")
+	dst := filepath.Join(tmp, "bar")
+	if err := os.WriteFile(src, []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkFile("relative-symlink", src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if target, err := os.Readlink(dst); err != nil || target != "foo" {
+		t.Fatalf("expected link target 'foo' but got '%s' with error '%v'", target, err)
+	}
+
+	item := &journalItem{Src: src, Dst: dst}
+	if err := item.record(dst); err != nil {
+		t.Fatal(err)
+	}
+	e := &journalEntry{Op: "relative-symlink", Items: []*journalItem{item}}
+
+	if err := e.check(true); err != nil {
+		t.Errorf("undo check should pass but got '%s'", err)
+	}
+	if err := e.check(false); err == nil {
+		t.Errorf("redo check should fail for existing link")
+	}
+
+	if err := os.Remove(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.check(false); err != nil {
+		t.Errorf("redo check should pass but got '%s'", err)
+	}
+}
+
+func TestJournalCheckRenameSwap(t *testing.T) {
+	tmp := t.TempDir()
+
+	a := filepath.Join(tmp, "a")
+	b := filepath.Join(tmp, "b")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte(path), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &journalEntry{Op: "rename", Items: []*journalItem{{Src: b, Dst: a}, {Src: a, Dst: b}}}
+	for _, item := range e.Items {
+		if err := item.record(item.Dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.check(true); err != nil {
+		t.Errorf("undo check should pass for swapped files but got '%s'", err)
+	}
+}
+
+func TestJournalCheckCopiedDir(t *testing.T) {
+	tmp := t.TempDir()
+
+	defer func(path string) { genJournalPath = path }(genJournalPath)
+	genJournalPath = filepath.Join(tmp, "fm", "journal")
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	file := filepath.Join(dst, "sub", "file")
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("foo"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := journalRecord("copy", []string{src}, []string{dst}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry but got %d", len(entries))
+	}
+	e := entries[0]
+
+	if err := e.check(true); err != nil {
+		t.Errorf("undo check should pass but got '%s'", err)
+	}
+
+	// changing a nested file changes neither the copied directory nor the
+	// directory of the file
+	if err := os.WriteFile(file, []byte("foobar"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.check(true); err == nil {
+		t.Errorf("undo check should fail for modified nested file")
+	}
+}
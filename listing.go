@@ -0,0 +1,198 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djherbis/times"
+	"github.com/pchchv/golog"
+)
+
+// listing is a virtual directory showing files from other directories, such as
+// the results of 'find-duplicates'. Files are shown with the given names but
+// keep their own paths, so that commands such as 'delete' work as usual.
+// Flat listings show the files under their directory instead, which are walked
+// again only when the listing is reloaded or the directory changes.
+type listing struct {
+	dir     string // directory used as the working directory
+	paths   []string
+	names   []string
+	flat    bool
+	depth   int  // maximum depth of flat listings, or 0 for no limit
+	stale   bool // flat listing needs to be walked again
+	modTime time.Time
+}
+
+// listingInfo is the file information of a file in a listing with the name
+// shown in the listing.
+type listingInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i *listingInfo) Name() string { return i.name }
+
+var listings = struct {
+	mutex sync.Mutex
+	m     map[string]*listing
+}{m: make(map[string]*listing)}
+
+// addListing adds a listing of the given files shown with the given names in
+// the given directory, and returns the path of the listing. A previous listing
+// with the same name in the directory is replaced.
+func addListing(dir, name string, paths, names []string) string {
+	path := filepath.Join(dir, "["+name+"]")
+
+	listings.mutex.Lock()
+	listings.m[path] = &listing{dir: dir, paths: paths, names: names, modTime: time.Now()}
+	listings.mutex.Unlock()
+
+	return path
+}
+
+// addFlatListing adds a flat listing of the files under the given directory
+// down to the given depth, and returns the path of the listing.
+func addFlatListing(dir string, depth int) string {
+	path := filepath.Join(dir, "[flatten]")
+
+	listings.mutex.Lock()
+	listings.m[path] = &listing{dir: dir, flat: true, depth: depth, stale: true, modTime: time.Now()}
+	listings.mutex.Unlock()
+
+	return path
+}
+
+// flattenDir returns the files under the given directory down to the given
+// depth, or all of them when depth is 0, along with their paths relative to the
+// directory. Hidden files and directories are left out unless the option
+// 'hidden' is enabled. Symbolic links to directories are not followed.
+func flattenDir(root string, depth int) (paths, names []string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			golog.Info("reading directory: %s", err)
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+
+		if genOpts.sortType.option&hiddenSort == 0 {
+			if info, err := d.Info(); err == nil && isHidden(info, filepath.Dir(path), genOpts.hiddenfiles) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		paths = append(paths, path)
+		names = append(names, rel)
+
+		if d.IsDir() && depth > 0 && strings.Count(rel, string(filepath.Separator))+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return paths, names
+}
+
+// isListingPath returns true if the given path is a listing or a path under a
+// listing, neither of which exists on disk.
+func isListingPath(p string) bool {
+	for curr := filepath.Clean(p); ; curr = filepath.Dir(curr) {
+		if _, ok := getListing(curr); ok {
+			return true
+		}
+		if filepath.Dir(curr) == curr {
+			return false
+		}
+	}
+}
+
+func getListing(path string) (*listing, bool) {
+	listings.mutex.Lock()
+	defer listings.mutex.Unlock()
+
+	l, ok := listings.m[path]
+	return l, ok
+}
+
+// touchListing marks the listing with the given path as modified so that it is
+// read again when it is checked. Flat listings are also walked again when
+// rewalk is set.
+func touchListing(path string, rewalk bool) {
+	listings.mutex.Lock()
+	defer listings.mutex.Unlock()
+
+	if l, ok := listings.m[path]; ok {
+		l.modTime = time.Now()
+		if rewalk && l.flat {
+			l.stale = true
+		}
+	}
+}
+
+func listingModTime(l *listing) time.Time {
+	listings.mutex.Lock()
+	defer listings.mutex.Unlock()
+
+	return l.modTime
+}
+
+// readListing returns the files of the given listing. Files that no longer
+// exist are left out.
+func readListing(l *listing) []*file {
+	listings.mutex.Lock()
+	walk := l.flat && l.stale
+	l.stale = false
+	listings.mutex.Unlock()
+
+	// the directory is walked without holding the lock as it may take long
+	if walk {
+		paths, names := flattenDir(l.dir, l.depth)
+		listings.mutex.Lock()
+		l.paths, l.names = paths, names
+		listings.mutex.Unlock()
+	}
+
+	listings.mutex.Lock()
+	paths, names := l.paths, l.names
+	listings.mutex.Unlock()
+
+	files := make([]*file, 0, len(paths))
+	for i, path := range paths {
+		lstat, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+
+		ts := times.Get(lstat)
+		ct := lstat.ModTime()
+		if ts.HasChangeTime() {
+			ct = ts.ChangeTime()
+		}
+
+		files = append(files, &file{
+			FileInfo:   &listingInfo{lstat, names[i]},
+			path:       path,
+			dirCount:   -1,
+			accessTime: ts.AccessTime(),
+			changeTime: ct,
+			ext:        filepath.Ext(path),
+		})
+	}
+
+	return files
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFlattenDir(t *testing.T) {
+	tmp := t.TempDir()
+
+	for _, path := range []string{"a", "dir/b", "dir/sub/c", ".hidden/d"} {
+		path = filepath.Join(tmp, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(option sortOption) { genOpts.sortType.option = option }(genOpts.sortType.option)
+	genOpts.sortType.option &= ^hiddenSort
+
+	tests := []struct {
+		depth int
+		exp   []string
+	}{
+		{0, []string{"a", "dir", "dir/b", "dir/sub", "dir/sub/c"}},
+		{1, []string{"a", "dir"}},
+		{2, []string{"a", "dir", "dir/b", "dir/sub"}},
+	}
+
+	for _, test := range tests {
+		paths, names := flattenDir(tmp, test.depth)
+		var exp []string
+		for _, name := range test.exp {
+			exp = append(exp, filepath.FromSlash(name))
+		}
+		if !reflect.DeepEqual(names, exp) {
+			t.Errorf("at input '%d' expected '%v' but got '%v'", test.depth, exp, names)
+		}
+		for i, path := range paths {
+			if path != filepath.Join(tmp, names[i]) {
+				t.Errorf("at input '%d' expected path of '%s' but got '%s'", test.depth, names[i], path)
+			}
+		}
+	}
+
+	genOpts.sortType.option |= hiddenSort
+	if _, names := flattenDir(tmp, 0); len(names) != 7 {
+		t.Errorf("expected hidden files to be listed but got '%v'", names)
+	}
+
+	path := addFlatListing(tmp, 1)
+	if err := os.WriteFile(filepath.Join(tmp, "e"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := readdir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 4 {
+		t.Errorf("expected new files to be listed but got '%d' files", len(listed))
+	}
+}
+
+func TestListingModTime(t *testing.T) {
+	tmp := t.TempDir()
+
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := addFlatListing(tmp, 0)
+	if _, err := readdir(path); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := statDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := statDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.ModTime().Equal(second.ModTime()) {
+		t.Errorf("expected stable modification time but got '%v' and '%v'", first.ModTime(), second.ModTime())
+	}
+
+	if err := os.Remove(filepath.Join(tmp, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "c"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// removed files are dropped without walking the directory again
+	touchListing(path, false)
+	listed, err := readdir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Name() != "b" {
+		t.Errorf("expected only 'b' to be listed but got '%d' files", len(listed))
+	}
+
+	touchListing(path, true)
+	third, err := statDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !third.ModTime().After(second.ModTime()) {
+		t.Errorf("expected modification time after '%v' but got '%v'", second.ModTime(), third.ModTime())
+	}
+	if listed, err = readdir(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 {
+		t.Errorf("expected new files to be listed after walking again but got '%d' files", len(listed))
+	}
+}
+
+func TestMakeFilesFlatListing(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := addFlatListing(tmp, 0)
+	nav := &nav{dirs: []*dir{{path: path}}}
+
+	for _, dir := range []bool{true, false} {
+		if _, err := nav.makeFiles([]string{"foo"}, dir); err != nil {
+			t.Errorf("at input '%v' making file: %s", dir, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(tmp, "foo")); err != nil || !info.IsDir() {
+		t.Errorf("expected directory in the flattened directory but got '%v'", err)
+	}
+
+	if _, err := nav.makeFiles([]string{filepath.Join(path, "bar")}, true); err == nil {
+		t.Errorf("expected an error for a directory inside the listing")
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("listing should not be created on disk")
+	}
+}
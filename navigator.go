@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/djherbis/times"
@@ -33,7 +34,6 @@ type file struct {
 	linkTarget string
 	path       string
 	dirCount   int
-	dirSize    int64
 	accessTime time.Time
 	changeTime time.Time
 	ext        string
@@ -62,7 +62,6 @@ type nav struct {
 	dirs            []*dir
 	copyBytes       int64
 	copyTotal       int64
-	copyUpdate      int
 	moveCount       int
 	moveTotal       int
 	moveUpdate      int
@@ -75,9 +74,24 @@ type nav struct {
 	moveTotalChan   chan int
 	deleteCountChan chan int
 	deleteTotalChan chan int
+	sizeChan        chan struct{}
+	duJob           *job
+	duSortType      sortType
+	duModeSortType  sortType
+	pasteRegister   string
+	pastePrompt     string
+	autoSizeDir     string
+	autoSizeJobs    []*job
+	conflictChan    chan string
+	conflictAnswer  chan string
+	conflictMutex   sync.Mutex
+	conflictPending bool
+	conflictQueued  string
 	previewChan     chan string
 	dirPreviewChan  chan *dir
 	dirChan         chan *dir
+	watchChan       chan []string
+	watcher         *watcher
 	regChan         chan *reg
 	dirCache        map[string]*dir
 	regCache        map[string]*reg
@@ -85,6 +99,11 @@ type nav struct {
 	marks           map[string]string
 	renameOldPath   string
 	renameNewPath   string
+	renameOlds      []string
+	renameNews      []string
+	chmodPath       string
+	chmodMode       os.FileMode
+	chmodOwner      string
 	selections      map[string]int
 	tags            map[string]string
 	selectionInd    int
@@ -99,6 +118,7 @@ type nav struct {
 	volatilePreview bool
 	jumpList        []string
 	jumpListInd     int
+	jobs            *jobList
 }
 
 type indexedSelections struct {
@@ -132,12 +152,17 @@ func newNav(height int) *nav {
 		moveTotalChan:   make(chan int, 1024),
 		deleteCountChan: make(chan int, 1024),
 		deleteTotalChan: make(chan int, 1024),
+		sizeChan:        make(chan struct{}, 1),
+		conflictChan:    make(chan string),
+		conflictAnswer:  make(chan string, 1),
 		previewChan:     make(chan string, 1024),
 		dirPreviewChan:  make(chan *dir, 1024),
 		dirChan:         make(chan *dir),
+		watchChan:       make(chan []string),
 		regChan:         make(chan *reg),
 		dirCache:        make(map[string]*dir),
 		regCache:        make(map[string]*reg),
+		jobs:            newJobList(),
 		saves:           make(map[string]bool),
 		marks:           make(map[string]string),
 		selections:      make(map[string]int),
@@ -153,10 +178,8 @@ func newNav(height int) *nav {
 
 func (file *file) TotalSize() int64 {
 	if file.IsDir() {
-		if file.dirSize >= 0 {
-			return file.dirSize
-		}
-		return 0
+		size, _ := file.dirTotal()
+		return size
 	}
 	return file.Size()
 }
@@ -252,6 +275,14 @@ func (dir *dir) sort() {
 		}
 	}
 
+	// directories with unknown total sizes are moved to the end regardless of
+	// the order, since their sizes cannot be compared with the others
+	if dir.sortType.method == sizeSort {
+		sort.SliceStable(dir.files, func(i, j int) bool {
+			return dir.files[i].sizeKnown() && !dir.files[j].sizeKnown()
+		})
+	}
+
 	if dir.sortType.option&dirfirstSort != 0 {
 		sort.SliceStable(dir.files, func(i, j int) bool {
 			if dir.files[i].IsDir() == dir.files[j].IsDir() {
@@ -373,8 +404,24 @@ func (nav *nav) loadDir(path string) *dir {
 	return nav.loadDirInternal(path)
 }
 
+// reloadDir reads the entries of the directory again in the background and
+// sends the new directory to dirChan.
+func (nav *nav) reloadDir(dir *dir) {
+	dir.loading = true
+	dir.loadTime = time.Now()
+	go func() {
+		nd := newDir(dir.path)
+		nd.filter = dir.filter
+		nd.sort()
+		if genOpts.dirpreviews {
+			nav.dirPreviewChan <- nd
+		}
+		nav.dirChan <- nd
+	}()
+}
+
 func (nav *nav) checkDir(dir *dir) {
-	s, err := os.Stat(dir.path)
+	s, err := statDir(dir.path)
 	if err != nil {
 		log.Printf("getting directory info: %s", err)
 		return
@@ -390,17 +437,7 @@ func (nav *nav) checkDir(dir *dir) {
 			return
 		}
 
-		dir.loading = true
-		dir.loadTime = now
-		go func() {
-			nd := newDir(dir.path)
-			nd.filter = dir.filter
-			nd.sort()
-			if genOpts.dirpreviews {
-				nav.dirPreviewChan <- nd
-			}
-			nav.dirChan <- nd
-		}()
+		nav.reloadDir(dir)
 	case dir.sortType != genOpts.sortType ||
 		dir.dironly != genOpts.dironly ||
 		!reflect.DeepEqual(dir.hiddenfiles, genOpts.hiddenfiles) ||
@@ -431,6 +468,7 @@ func (nav *nav) getDirs(wd string) {
 	}
 
 	nav.dirs = dirs
+	nav.updateWatches()
 }
 
 func (nav *nav) addJumpList() {
@@ -465,11 +503,14 @@ func (nav *nav) cdJumpListNext() {
 
 func (nav *nav) renew() {
 	for _, d := range nav.dirs {
+		// listings do not change on their own, so their files are checked
+		// again here to drop the removed ones
+		touchListing(d.path, false)
 		nav.checkDir(d)
 	}
 
 	for m := range nav.selections {
-		if _, err := os.Lstat(m); os.IsNotExist(err) {
+		if _, err := archiveLstat(m); os.IsNotExist(err) {
 			delete(nav.selections, m)
 		}
 	}
@@ -477,9 +518,15 @@ func (nav *nav) renew() {
 	if len(nav.selections) == 0 {
 		nav.selectionInd = 0
 	}
+
+	nav.updateWatches()
 }
 
 func (nav *nav) reload() error {
+	for _, d := range nav.dirs {
+		touchListing(d.path, true)
+	}
+
 	nav.dirCache = make(map[string]*dir)
 	nav.regCache = make(map[string]*reg)
 
@@ -488,6 +535,13 @@ func (nav *nav) reload() error {
 		return fmt.Errorf("getting current directory: %s", err)
 	}
 
+	// the working directory differs inside archives and listings
+	if len(nav.dirs) != 0 {
+		if path := nav.currDir().path; workDir(path) != path {
+			wd = path
+		}
+	}
+
 	curr, err := nav.currFile()
 	nav.getDirs(wd)
 	if err == nil {
@@ -584,7 +638,8 @@ func (nav *nav) previewDir(dir *dir, win *win) {
 
 	var reader io.Reader
 
-	if len(genOpts.previewer) != 0 {
+	// previewers can not read directories inside archives
+	if _, _, ok := splitArchivePath(dir.path); len(genOpts.previewer) != 0 && !ok {
 		nav.exportFiles()
 		exportOpts()
 		cmd := exec.Command(genOpts.previewer, dir.path,
@@ -642,7 +697,17 @@ func (nav *nav) preview(path string, win *win) {
 
 	var reader io.Reader
 
-	if len(genOpts.previewer) != 0 {
+	// previewers can not read files inside archives
+	if isArchivePath(path) {
+		f, err := openArchiveEntry(path)
+		if err != nil {
+			log.Printf("opening file: %s", err)
+			return
+		}
+
+		defer f.Close()
+		reader = f
+	} else if len(genOpts.previewer) != 0 {
 		nav.exportFiles()
 		exportOpts()
 		cmd := exec.Command(genOpts.previewer, path,
@@ -886,8 +951,9 @@ func (nav *nav) updir() error {
 	dir := nav.currDir()
 
 	nav.dirs = nav.dirs[:len(nav.dirs)-1]
+	nav.updateWatches()
 
-	if err := os.Chdir(filepath.Dir(dir.path)); err != nil {
+	if err := chdir(filepath.Dir(dir.path)); err != nil {
 		return fmt.Errorf("updir: %s", err)
 	}
 
@@ -905,8 +971,9 @@ func (nav *nav) open() error {
 	dir := nav.loadDir(path)
 
 	nav.dirs = append(nav.dirs, dir)
+	nav.updateWatches()
 
-	if err := os.Chdir(path); err != nil {
+	if err := chdir(path); err != nil {
 		return fmt.Errorf("open: %s", err)
 	}
 
@@ -1048,8 +1115,7 @@ func (nav *nav) tag(tag string) error {
 func (nav *nav) invert() {
 	dir := nav.currDir()
 	for _, f := range dir.files {
-		path := filepath.Join(dir.path, f.Name())
-		nav.toggleSelection(path)
+		nav.toggleSelection(f.path)
 	}
 }
 
@@ -1058,51 +1124,86 @@ func (nav *nav) unselect() {
 	nav.selectionInd = 0
 }
 
-func (nav *nav) save(cp bool) error {
+// save saves the current file or the selections to the given register to be
+// copied or moved. When add is true, the files are added to the files already
+// in the register, which should then be waiting for the same operation. It
+// returns the number of files in the register.
+func (nav *nav) save(reg string, cp, add bool) (int, error) {
 	list, err := nav.currFileOrSelections()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if err := saveFiles(list, cp); err != nil {
-		return err
-	}
+	if add {
+		old, oldCp, err := loadFiles(reg)
+		if err != nil {
+			return 0, err
+		}
+		if len(old) > 0 && oldCp != cp {
+			op := "move"
+			if oldCp {
+				op = "copy"
+			}
+			return 0, fmt.Errorf("register holds files to %s", op)
+		}
 
-	nav.saves = make(map[string]bool)
-	for _, f := range list {
-		nav.saves[f] = cp
+		saved := make(map[string]bool)
+		for _, f := range old {
+			saved[f] = true
+		}
+		for _, f := range list {
+			if !saved[f] {
+				old = append(old, f)
+			}
+		}
+		list = old
 	}
 
-	return nil
-}
-
-func (nav *nav) copyAsync(app *app, srcs []string, dstDir string) {
-	echo := &callExpr{"echoerr", []string{""}, 1}
+	if err := saveFiles(reg, list, cp); err != nil {
+		return 0, err
+	}
 
-	_, err := os.Stat(dstDir)
-	if os.IsNotExist(err) {
-		echo.args[0] = err.Error()
-		app.ui.exprChan <- echo
-		return
+	// only the files in the unnamed register are highlighted
+	if reg == "" {
+		nav.saves = make(map[string]bool)
+		for _, f := range list {
+			nav.saves[f] = cp
+		}
 	}
 
-	total, err := copySize(srcs)
+	return len(list), nil
+}
+
+// copyWait copies the given sources to the given destinations while showing
+// the progress in the ruler, and reports errors in the message line. It returns
+// the updated error count.
+func (nav *nav) copyWait(app *app, j *job, srcs, dsts []string, replace conflictFunc, echo *callExpr, errCount int) int {
+	total, err := copyEntriesSize(srcs)
 	if err != nil {
-		echo.args[0] = err.Error()
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
 		app.ui.exprChan <- echo
-		return
+		return errCount
 	}
 
-	nav.copyTotalChan <- total
+	nums, errs := copyEntries(srcs, dsts, replace, j)
+
+	return nav.progressWait(app, j, total, nums, errs, echo, errCount)
+}
 
-	nums, errs := copyAll(srcs, dstDir)
+// progressWait shows the progress of a file operation reporting the number of
+// processed bytes and errors through the given channels until the error channel
+// is closed. It returns the updated error count.
+func (nav *nav) progressWait(app *app, j *job, total int64, nums chan int64, errs chan error, echo *callExpr, errCount int) int {
+	nav.copyTotalChan <- total
+	j.addTotalBytes(total)
 
-	errCount := 0
 loop:
 	for {
 		select {
 		case n := <-nums:
 			nav.copyBytesChan <- n
+			j.addBytes(n)
 		case err, ok := <-errs:
 			if !ok {
 				break loop
@@ -1113,8 +1214,192 @@ loop:
 		}
 	}
 
+	// progress sent right before closing the error channel may remain
+	for {
+		select {
+		case n := <-nums:
+			nav.copyBytesChan <- n
+			j.addBytes(n)
+			continue
+		default:
+		}
+		break
+	}
+
 	nav.copyTotalChan <- -total
 
+	return errCount
+}
+
+// moveFile renames the given source to the given destination, and falls back
+// to copying and then deleting the source for cross-device moves. Partially
+// copied files are removed when the job is cancelled. It returns the updated
+// error count.
+func (nav *nav) moveFile(app *app, j *job, src, dst string, echo *callExpr, errCount int) int {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return errCount
+	}
+
+	if !errCrossDevice(err) {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+		app.ui.exprChan <- echo
+		return errCount
+	}
+
+	oldCount := errCount
+	errCount = nav.copyWait(app, j, []string{src}, []string{dst}, nil, echo, errCount)
+
+	if j.isCancelled() {
+		os.RemoveAll(dst)
+		return errCount
+	}
+
+	// source is kept if any file failed to copy or verify
+	if errCount == oldCount {
+		if err := os.RemoveAll(src); err != nil {
+			errCount++
+			echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+			app.ui.exprChan <- echo
+		}
+	}
+
+	return errCount
+}
+
+// askConflict asks the user whether the given existing file should be replaced
+// and waits for the answer. Only a single question is shown at a time.
+func (nav *nav) askConflict(dst string) string {
+	nav.conflictMutex.Lock()
+	defer nav.conflictMutex.Unlock()
+
+	nav.conflictChan <- dst
+	return <-nav.conflictAnswer
+}
+
+// conflictFunc returns the function to resolve conflicts of a paste operation
+// according to the 'pasteconflict' option.
+func (nav *nav) conflictFunc() conflictFunc {
+	switch genOpts.pasteconflict {
+	case "overwrite":
+		return func(src os.FileInfo, dst string) bool {
+			return true
+		}
+	case "newer":
+		return func(src os.FileInfo, dst string) bool {
+			dstInfo, err := os.Lstat(dst)
+			return err == nil && src.ModTime().After(dstInfo.ModTime())
+		}
+	case "ask":
+		var all, none bool
+		return func(src os.FileInfo, dst string) bool {
+			if all || none {
+				return all
+			}
+			switch nav.askConflict(dst) {
+			case "y":
+				return true
+			case "a":
+				all = true
+				return true
+			case "s":
+				none = true
+			}
+			return false
+		}
+	}
+
+	return nil
+}
+
+// moveMerge moves the given source to the given existing destination. When
+// both are directories, their contents are merged recursively, otherwise the
+// given function is used to decide whether the destination should be
+// replaced. It returns the updated error count.
+func (nav *nav) moveMerge(app *app, j *job, src, dst string, replace conflictFunc, echo *callExpr, errCount int) int {
+	if j.check() != nil {
+		return errCount
+	}
+
+	srcStat, err := os.Lstat(src)
+	if err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+		app.ui.exprChan <- echo
+		return errCount
+	}
+
+	dstStat, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return nav.moveFile(app, j, src, dst, echo, errCount)
+	}
+
+	if srcStat.IsDir() && dstStat.IsDir() {
+		names, err := readDirNames(src)
+		if err != nil {
+			errCount++
+			echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+			app.ui.exprChan <- echo
+			return errCount
+		}
+		for _, name := range names {
+			errCount = nav.moveMerge(app, j, filepath.Join(src, name), filepath.Join(dst, name), replace, echo, errCount)
+		}
+		// skipped files are left in the source directory
+		os.Remove(src)
+		return errCount
+	}
+
+	if replace == nil || !replace(srcStat, dst) {
+		return errCount
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+		app.ui.exprChan <- echo
+		return errCount
+	}
+
+	return nav.moveFile(app, j, src, dst, echo, errCount)
+}
+
+func (nav *nav) copyAsync(app *app, srcs []string, dstDir string) {
+	echo := &callExpr{"echoerr", []string{""}, 1}
+
+	_, err := os.Stat(dstDir)
+	if os.IsNotExist(err) {
+		echo.args[0] = err.Error()
+		app.ui.exprChan <- echo
+		return
+	}
+
+	j := nav.jobs.add("copy", dstDir)
+	defer nav.jobs.remove(j)
+
+	// files replacing or merged into existing files are not journaled since
+	// undoing the operation would remove the existing files as well
+	var created, createdDsts []string
+
+	dsts := make([]string, len(srcs))
+	for i, src := range srcs {
+		dst := copyDest(src, dstDir)
+		if _, err := os.Lstat(dst); os.IsNotExist(err) {
+			created = append(created, src)
+			createdDsts = append(createdDsts, dst)
+		}
+		dsts[i] = dst
+	}
+
+	errCount := nav.copyWait(app, j, srcs, dsts, nav.conflictFunc(), echo, 0)
+
+	if err := journalRecord("copy", created, createdDsts); err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] journal: %s", errCount, err)
+		app.ui.exprChan <- echo
+	}
+
 	if genSingleMode {
 		nav.renew()
 		app.ui.loadFile(app, true)
@@ -1126,7 +1411,9 @@ loop:
 		}
 	}
 
-	if errCount == 0 {
+	if j.isCancelled() {
+		app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+	} else if errCount == 0 {
 		app.ui.exprChan <- &callExpr{"echo", []string{"\033[0;32mCopied successfully\033[0m"}, 1}
 	}
 }
@@ -1141,11 +1428,27 @@ func (nav *nav) moveAsync(app *app, srcs []string, dstDir string) {
 		return
 	}
 
+	j := nav.jobs.add("move", dstDir)
+	defer nav.jobs.remove(j)
+
 	nav.moveTotalChan <- len(srcs)
+	j.addTotalCount(int64(len(srcs)))
+
+	replace := nav.conflictFunc()
+
+	// files replacing or merged into existing files are not journaled since
+	// undoing the operation would not restore the existing files
+	var moved, dsts []string
 
 	errCount := 0
 	for _, src := range srcs {
+		if j.check() != nil {
+			break
+		}
+
 		nav.moveCountChan <- 1
+		j.addCount(1)
+		j.setFile(src)
 
 		srcStat, err := os.Lstat(src)
 		if err != nil {
@@ -1164,62 +1467,33 @@ func (nav *nav) moveAsync(app *app, srcs []string, dstDir string) {
 			app.ui.exprChan <- echo
 			continue
 		} else if !os.IsNotExist(err) {
-			var newPath string
-			for i := 1; !os.IsNotExist(err); i++ {
-				newPath = fmt.Sprintf("%s.~%d~", dst, i)
-				_, err = os.Lstat(newPath)
+			if genOpts.pasteconflict != "rename" {
+				errCount = nav.moveMerge(app, j, src, dst, replace, echo, errCount)
+				continue
 			}
-			dst = newPath
+			dst = numberedPath(dst)
 		}
 
-		if err := os.Rename(src, dst); err != nil {
-			if errCrossDevice(err) {
-				total, err := copySize([]string{src})
-				if err != nil {
-					echo.args[0] = err.Error()
-					app.ui.exprChan <- echo
-					continue
-				}
-
-				nav.copyTotalChan <- total
-
-				nums, errs := copyAll([]string{src}, dstDir)
-
-				oldCount := errCount
-			loop:
-				for {
-					select {
-					case n := <-nums:
-						nav.copyBytesChan <- n
-					case err, ok := <-errs:
-						if !ok {
-							break loop
-						}
-						errCount++
-						echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
-						app.ui.exprChan <- echo
-					}
-				}
-
-				nav.copyTotalChan <- -total
-
-				if errCount == oldCount {
-					if err := os.RemoveAll(src); err != nil {
-						errCount++
-						echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
-						app.ui.exprChan <- echo
-					}
-				}
-			} else {
-				errCount++
-				echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
-				app.ui.exprChan <- echo
-			}
+		oldCount := errCount
+		errCount = nav.moveFile(app, j, src, dst, echo, errCount)
+		if errCount == oldCount && !j.isCancelled() {
+			moved = append(moved, src)
+			dsts = append(dsts, dst)
 		}
 	}
 
+	// count skipped items of cancelled jobs so the ruler is reset properly
+	if _, _, count, _ := j.progress(); count < int64(len(srcs)) {
+		nav.moveCountChan <- len(srcs) - int(count)
+	}
 	nav.moveTotalChan <- -len(srcs)
 
+	if err := journalRecord("move", moved, dsts); err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] journal: %s", errCount, err)
+		app.ui.exprChan <- echo
+	}
+
 	if genSingleMode {
 		nav.renew()
 		app.ui.loadFile(app, true)
@@ -1231,13 +1505,109 @@ func (nav *nav) moveAsync(app *app, srcs []string, dstDir string) {
 		}
 	}
 
-	if errCount == 0 {
+	if j.isCancelled() {
+		app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+	} else if errCount == 0 {
 		app.ui.exprChan <- &callExpr{"echo", []string{"\033[0;32mMoved successfully\033[0m"}, 1}
 	}
 }
 
-func (nav *nav) paste(app *app) error {
-	srcs, cp, err := loadFiles()
+// linkAsync creates links of the given kind to the given sources in the given
+// directory. Existing files are handled according to the 'pasteconflict'
+// option, though existing directories are never merged or replaced.
+func (nav *nav) linkAsync(app *app, kind string, srcs []string, dstDir string) {
+	echo := &callExpr{"echoerr", []string{""}, 1}
+
+	j := nav.jobs.add("link", dstDir)
+	defer nav.jobs.remove(j)
+
+	j.addTotalCount(int64(len(srcs)))
+
+	replace := nav.conflictFunc()
+
+	// links replacing existing files are not journaled since undoing the
+	// operation would not bring the replaced files back
+	var linked, dsts []string
+
+	errCount := 0
+	fail := func(err error) {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+		app.ui.exprChan <- echo
+	}
+
+	for _, src := range srcs {
+		if j.check() != nil {
+			break
+		}
+
+		j.addCount(1)
+		j.setFile(src)
+
+		srcStat, err := os.Lstat(src)
+		if err != nil {
+			fail(err)
+			continue
+		}
+
+		dst := filepath.Join(dstDir, filepath.Base(src))
+
+		replaced := false
+		if _, err := os.Lstat(dst); err == nil {
+			if genOpts.pasteconflict == "rename" {
+				dst = numberedPath(dst)
+			} else if sameFile(src, dst) {
+				// replacing the destination would remove the source
+				fail(fmt.Errorf("source and destination are the same file: %s", src))
+				continue
+			} else if replace == nil || !replace(srcStat, dst) {
+				continue
+			} else if err := os.Remove(dst); err != nil {
+				fail(err)
+				continue
+			} else {
+				replaced = true
+			}
+		}
+
+		if err := linkFile(kind, src, dst); err != nil {
+			fail(err)
+			continue
+		}
+
+		if !replaced {
+			linked = append(linked, src)
+			dsts = append(dsts, dst)
+		}
+	}
+
+	if err := journalRecord(kind, linked, dsts); err != nil {
+		errCount++
+		echo.args[0] = fmt.Sprintf("[%d] journal: %s", errCount, err)
+		app.ui.exprChan <- echo
+	}
+
+	if genSingleMode {
+		nav.renew()
+		app.ui.loadFile(app, true)
+	} else {
+		if err := remote("send load"); err != nil {
+			fail(err)
+		}
+	}
+
+	if j.isCancelled() {
+		app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+	} else if errCount == 0 {
+		app.ui.exprChan <- &callExpr{"echo", []string{"\033[0;32mLinked successfully\033[0m"}, 1}
+	}
+}
+
+// pasteLink creates links of the given kind to the files in the given register
+// in the current directory. The register is kept as is since the linked files
+// are not changed.
+func (nav *nav) pasteLink(app *app, kind, reg string) error {
+	srcs, _, err := loadFiles(reg)
 	if err != nil {
 		return err
 	}
@@ -1246,13 +1616,49 @@ func (nav *nav) paste(app *app) error {
 		return errors.New("no file in copy/cut buffer")
 	}
 
-	dstDir := nav.currDir().path
+	dstDir := nav.fileDir()
+	if _, _, ok := splitArchivePath(dstDir); ok {
+		return errors.New("archives are read-only")
+	}
+	for _, src := range srcs {
+		if isArchivePath(src) {
+			return errors.New("files inside archives can only be copied")
+		}
+	}
+
+	go nav.linkAsync(app, kind, srcs, dstDir)
+
+	return nil
+}
+
+func (nav *nav) paste(app *app, reg string) error {
+	srcs, cp, err := loadFiles(reg)
+	if err != nil {
+		return err
+	}
+
+	if len(srcs) == 0 {
+		return errors.New("no file in copy/cut buffer")
+	}
+
+	dstDir := nav.fileDir()
+	if _, _, ok := splitArchivePath(dstDir); ok {
+		return errors.New("archives are read-only")
+	}
+
+	if !cp {
+		for _, src := range srcs {
+			if isArchivePath(src) {
+				return errors.New("files inside archives can only be copied")
+			}
+		}
+	}
 
 	if cp {
 		go nav.copyAsync(app, srcs, dstDir)
 	} else {
 		go nav.moveAsync(app, srcs, dstDir)
-		if err := saveFiles(nil, false); err != nil {
+		if err := saveFiles(reg, nil, false); err != nil {
 			return fmt.Errorf("clearing copy/cut buffer: %s", err)
 		}
 
@@ -1270,30 +1676,72 @@ func (nav *nav) paste(app *app) error {
 	return nil
 }
 
-func (nav *nav) del(app *app) error {
+func (nav *nav) del(app *app, trashed bool) error {
 	list, err := nav.currFileOrSelections()
 	if err != nil {
 		return err
 	}
+	if err := checkArchivePaths(list); err != nil {
+		return err
+	}
+
+	kind := "delete"
+	if trashed {
+		kind = "trash"
+	}
+
+	j := nav.jobs.add(kind, filepath.Dir(list[0]))
 
 	go func() {
+		defer nav.jobs.remove(j)
+
 		echo := &callExpr{"echoerr", []string{""}, 1}
 		errCount := 0
 
 		nav.deleteTotalChan <- len(list)
+		j.addTotalCount(int64(len(list)))
 
+		var srcs, dsts []string
 		for _, path := range list {
+			if j.check() != nil {
+				break
+			}
+
 			nav.deleteCountChan <- 1
+			j.addCount(1)
+			j.setFile(path)
 
-			if err := os.RemoveAll(path); err != nil {
+			if trashed {
+				dst, err := trash(path)
+				if err != nil {
+					errCount++
+					echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
+					app.ui.exprChan <- echo
+					continue
+				}
+				srcs = append(srcs, path)
+				dsts = append(dsts, dst)
+			} else if err := os.RemoveAll(path); err != nil {
 				errCount++
 				echo.args[0] = fmt.Sprintf("[%d] %s", errCount, err)
 				app.ui.exprChan <- echo
 			}
 		}
 
+		// count skipped items of cancelled jobs so the ruler is reset properly
+		if _, _, count, _ := j.progress(); count < int64(len(list)) {
+			nav.deleteCountChan <- len(list) - int(count)
+		}
 		nav.deleteTotalChan <- -len(list)
 
+		if trashed {
+			if err := journalRecord("trash", srcs, dsts); err != nil {
+				errCount++
+				echo.args[0] = fmt.Sprintf("[%d] journal: %s", errCount, err)
+				app.ui.exprChan <- echo
+			}
+		}
+
 		if genSingleMode {
 			nav.renew()
 			app.ui.loadFile(app, true)
@@ -1304,6 +1752,10 @@ func (nav *nav) del(app *app) error {
 				app.ui.exprChan <- echo
 			}
 		}
+
+		if j.isCancelled() {
+			app.ui.exprChan <- &callExpr{"echo", []string{fmt.Sprintf("Job %d cancelled", j.id)}, 1}
+		}
 	}()
 
 	return nil
@@ -1330,11 +1782,78 @@ func (nav *nav) rename() error {
 
 	dir.sel(lstat.Name(), nav.height)
 
+	if err := journalRecord("rename", []string{oldPath}, []string{newPath}); err != nil {
+		return fmt.Errorf("journal: %s", err)
+	}
+
 	return nil
 }
 
+// fileDir returns the directory that names given to commands are relative to,
+// and the directory where files are pasted. This is the current directory, or
+// the directory of the listing in listings since they do not exist on disk.
+func (nav *nav) fileDir() string {
+	dir := nav.currDir().path
+	if l, ok := getListing(dir); ok {
+		return l.dir
+	}
+	return dir
+}
+
+// makeFiles creates directories or empty files with the given names, which are
+// relative to the current directory unless they are absolute. Parent
+// directories are created as needed. Existing directories are kept as is and
+// times of existing files are updated as in 'touch'. It returns the paths of
+// the created files until the first error.
+func (nav *nav) makeFiles(names []string, dir bool) ([]string, error) {
+	var paths []string
+
+	for _, name := range names {
+		path := filepath.Clean(replaceTilde(name))
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(nav.fileDir(), path)
+		}
+		if isArchivePath(path) {
+			return paths, errors.New("archives are read-only")
+		}
+		if isListingPath(path) {
+			return paths, errors.New("listings can not contain new files")
+		}
+
+		if dir {
+			if err := os.MkdirAll(path, os.ModePerm); err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+			continue
+		}
+
+		// existing files and directories only get their times updated
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				return paths, err
+			}
+
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o666)
+			if err != nil {
+				return paths, err
+			}
+			f.Close()
+		}
+
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
 func (nav *nav) sync() error {
-	list, cp, err := loadFiles()
+	list, cp, err := loadFiles("")
 	if err != nil {
 		return err
 	}
@@ -1367,7 +1886,7 @@ func (nav *nav) cd(wd string) error {
 		wd = filepath.Join(nav.currDir().path, wd)
 	}
 
-	if err := os.Chdir(wd); err != nil {
+	if err := chdir(wd); err != nil {
 		return fmt.Errorf("cd: %s", err)
 	}
 
@@ -1380,7 +1899,7 @@ func (nav *nav) sel(path string) error {
 	path = replaceTilde(path)
 	path = filepath.Clean(path)
 
-	lstat, err := os.Lstat(path)
+	lstat, err := archiveLstat(path)
 	if err != nil {
 		return fmt.Errorf("select: %s", err)
 	}
@@ -1415,7 +1934,7 @@ func (nav *nav) globSel(pattern string, invert bool) error {
 		}
 		if matched {
 			anyMatched = true
-			fpath := filepath.Join(dir.path, dir.files[i].Name())
+			fpath := dir.files[i].path
 			if _, ok := nav.selections[fpath]; ok == invert {
 				nav.toggleSelection(fpath)
 			}
@@ -1669,10 +2188,25 @@ func (nav *nav) currSelections() []string {
 		currDirPath = nav.currDir().path
 	}
 
+	inDir := func(path string) bool {
+		return filepath.Dir(path) == currDirPath
+	}
+
+	// files of listings are in other directories
+	if l, ok := getListing(currDirPath); ok && currDirOnly {
+		paths := make(map[string]bool, len(l.paths))
+		for _, path := range l.paths {
+			paths[path] = true
+		}
+		inDir = func(path string) bool {
+			return paths[path]
+		}
+	}
+
 	paths := make([]string, 0, len(nav.selections))
 	indices := make([]int, 0, len(nav.selections))
 	for path, index := range nav.selections {
-		if !currDirOnly || filepath.Dir(path) == currDirPath {
+		if !currDirOnly || inDir(path) {
 			paths = append(paths, path)
 			indices = append(indices, index)
 		}
@@ -1694,49 +2228,46 @@ func (nav *nav) currFileOrSelections() (list []string, err error) {
 	return sel, nil
 }
 
-func (nav *nav) calcDirSize() error {
-	calc := func(f *file) error {
-		if f.IsDir() {
-			total, err := copySize([]string{f.path})
-			if err != nil {
-				return err
-			}
-			f.dirSize = total
-		}
-		return nil
-	}
-
+// calcDirSize calculates the total sizes of the current directory or the
+// selected directories in the background.
+func (nav *nav) calcDirSize(app *app) error {
+	var paths []string
 	if len(nav.selections) == 0 {
 		curr, err := nav.currFile()
 		if err != nil {
 			return errors.New("no file selected")
 		}
-		return calc(curr)
-	}
-
-	for sel := range nav.selections {
-		lstat, err := os.Lstat(sel)
-		if err != nil || !lstat.IsDir() {
-			continue
+		if curr.IsDir() {
+			paths = append(paths, curr.path)
 		}
-		path, name := filepath.Dir(sel), filepath.Base(sel)
-		dir := nav.loadDir(path)
-
-		for _, f := range dir.files {
-			if f.Name() == name {
-				err := calc(f)
-				if err != nil {
-					return err
-				}
-				break
+	} else {
+		for sel := range nav.selections {
+			if lstat, err := os.Lstat(sel); err == nil && lstat.IsDir() {
+				paths = append(paths, sel)
 			}
 		}
+		sort.Strings(paths)
+	}
+
+	for _, path := range paths {
+		if isArchivePath(path) {
+			return errors.New("sizes of directories inside archives cannot be calculated")
+		}
 	}
 
+	nav.calcDirSizes(app, paths, false)
 	return nil
 }
 
 func readdir(path string) ([]*file, error) {
+	if l, ok := getListing(path); ok {
+		return readListing(l), nil
+	}
+
+	if archive, name, ok := splitArchivePath(path); ok {
+		return readArchiveDir(archive, name)
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -1812,7 +2343,6 @@ func readdir(path string) ([]*file, error) {
 			linkTarget: linkTarget,
 			path:       fpath,
 			dirCount:   dirCount,
-			dirSize:    -1,
 			accessTime: at,
 			changeTime: ct,
 			ext:        ext,
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMakeFilesExisting(t *testing.T) {
+	tmp := t.TempDir()
+
+	dir := filepath.Join(tmp, "dir")
+	if err := os.Mkdir(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.Local)
+	if err := os.Chtimes(dir, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := (&nav{}).makeFiles([]string{dir}, false)
+	if err != nil {
+		t.Fatalf("touching directory: %s", err)
+	}
+	if len(paths) != 1 || paths[0] != dir {
+		t.Errorf("expected '%s' but got '%v'", dir, paths)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || !info.ModTime().After(old) {
+		t.Errorf("expected directory with updated modification time but got '%v'", info.ModTime())
+	}
+}
+
+func TestMakeFilesListing(t *testing.T) {
+	tmp := t.TempDir()
+
+	path := addListing(tmp, "duplicates", nil, nil)
+	nav := &nav{dirs: []*dir{{path: path}}}
+
+	if got := nav.fileDir(); got != tmp {
+		t.Errorf("expected '%s' but got '%s'", tmp, got)
+	}
+
+	paths, err := nav.makeFiles([]string{"foo"}, true)
+	if err != nil {
+		t.Fatalf("making directory: %s", err)
+	}
+	if exp := filepath.Join(tmp, "foo"); len(paths) != 1 || paths[0] != exp {
+		t.Errorf("expected '%s' but got '%v'", exp, paths)
+	}
+
+	if _, err := nav.makeFiles([]string{filepath.Join(path, "bar")}, false); err == nil {
+		t.Errorf("expected an error for a file inside the listing")
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("listing should not be created on disk")
+	}
+}
@@ -20,7 +20,9 @@ const (
 
 var genOpts struct {
 	anchorfind     bool
+	archivedirs    bool
 	autoquit       bool
+	autodirsize    bool
 	dircache       bool
 	dircounts      bool
 	dironly        bool
@@ -35,12 +37,16 @@ var genOpts struct {
 	mouse          bool
 	number         bool
 	preview        bool
+	progressbar    bool
 	relativenumber bool
 	smartcase      bool
 	smartdia       bool
+	verifycopy     bool
 	waitmsg        string
+	watch          bool
 	wrapscan       bool
 	wrapscroll     bool
+	copyworkers    int
 	findlen        int
 	period         int
 	scrolloff      int
@@ -50,6 +56,10 @@ var genOpts struct {
 	ifs            string
 	previewer      string
 	cleaner        string
+	clipboardcopy  string
+	clipboardpaste string
+	deletemode     string
+	pasteconflict  string
 	promptfmt      string
 	selmode        string
 	shell          string
@@ -62,6 +72,7 @@ var genOpts struct {
 	hiddenfiles    []string
 	history        bool
 	info           []string
+	preserve       []string
 	shellopts      []string
 	keys           map[string]expr
 	cmdkeys        map[string]expr
@@ -83,7 +94,9 @@ type sortType struct {
 
 func init() {
 	genOpts.anchorfind = true
+	genOpts.archivedirs = true
 	genOpts.autoquit = false
+	genOpts.autodirsize = false
 	genOpts.dircache = true
 	genOpts.dircounts = false
 	genOpts.dironly = false
@@ -98,12 +111,16 @@ func init() {
 	genOpts.mouse = false
 	genOpts.number = false
 	genOpts.preview = true
+	genOpts.progressbar = false
 	genOpts.relativenumber = false
 	genOpts.smartcase = true
 	genOpts.smartdia = false
+	genOpts.verifycopy = false
 	genOpts.waitmsg = "Press any key to continue"
+	genOpts.watch = true
 	genOpts.wrapscan = true
 	genOpts.wrapscroll = false
+	genOpts.copyworkers = 1
 	genOpts.findlen = 1
 	genOpts.period = 0
 	genOpts.scrolloff = 0
@@ -113,6 +130,10 @@ func init() {
 	genOpts.ifs = ""
 	genOpts.previewer = ""
 	genOpts.cleaner = ""
+	genOpts.clipboardcopy = ""
+	genOpts.clipboardpaste = ""
+	genOpts.deletemode = "delete"
+	genOpts.pasteconflict = "rename"
 	genOpts.promptfmt = "\033[32;1m%u@%h\033[0m:\033[34;1m%d\033[0m\033[1m%f\033[0m"
 	genOpts.selmode = "all"
 	genOpts.shell = genDefaultShell
@@ -125,6 +146,7 @@ func init() {
 	genOpts.hiddenfiles = []string{".*"}
 	genOpts.history = true
 	genOpts.info = nil
+	genOpts.preserve = []string{"mode"}
 	genOpts.shellopts = nil
 	genOpts.sortType = sortType{naturalSort, dirfirstSort}
 	genOpts.tempmarks = "'"
@@ -168,6 +190,7 @@ func init() {
 	genOpts.keys["d"] = &callExpr{"cut", nil, 1}
 	genOpts.keys["c"] = &callExpr{"clear", nil, 1}
 	genOpts.keys["p"] = &callExpr{"paste", nil, 1}
+	genOpts.keys["P"] = &callExpr{"chmod-edit", nil, 1}
 	genOpts.keys["<c-l>"] = &callExpr{"redraw", nil, 1}
 	genOpts.keys["<c-r>"] = &callExpr{"reload", nil, 1}
 	genOpts.keys[":"] = &callExpr{"read", nil, 1}
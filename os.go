@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -11,6 +12,8 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/djherbis/times"
+	"github.com/gdamore/tcell/v2"
 	"golang.org/x/sys/unix"
 )
 
@@ -25,6 +28,9 @@ var (
 	genDefaultSocketProt = "unix"
 	genDefaultSocketPath string
 
+	// command to edit the file given as the first argument
+	genEditFileCmd = `$EDITOR "$1"`
+
 	genUser        *user.User
 	genConfigPaths []string
 	genColorsPaths []string
@@ -32,7 +38,10 @@ var (
 	genFilesPath   string
 	genMarksPath   string
 	genTagsPath    string
+	genSetsPath    string
 	genHistoryPath string
+	genJournalPath string
+	genTrashPath   string
 )
 
 func init() {
@@ -103,7 +112,10 @@ func init() {
 	genFilesPath = filepath.Join(data, "fm", "files")
 	genMarksPath = filepath.Join(data, "fm", "marks")
 	genTagsPath = filepath.Join(data, "fm", "tags")
+	genSetsPath = filepath.Join(data, "fm", "selections")
 	genHistoryPath = filepath.Join(data, "fm", "history")
+	genJournalPath = filepath.Join(data, "fm", "journal")
+	genTrashPath = filepath.Join(data, "Trash")
 
 	runtime := os.Getenv("XDG_RUNTIME_DIR")
 	if runtime == "" {
@@ -113,6 +125,17 @@ func init() {
 	genDefaultSocketPath = filepath.Join(runtime, fmt.Sprintf("fm.%s.sock", genUser.Username))
 }
 
+// newScreen returns a screen along with the terminal it writes to, which is
+// used to write escape sequences that are not supported by tcell.
+func newScreen() (tcell.Screen, io.Writer, error) {
+	tty, err := tcell.NewDevTty()
+	if err != nil {
+		return nil, nil, err
+	}
+	screen, err := tcell.NewTerminfoScreenFromTty(tty)
+	return screen, tty, err
+}
+
 func detachedCommand(name string, arg ...string) *exec.Cmd {
 	cmd := exec.Command(name, arg...)
 	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true}
@@ -203,6 +226,33 @@ func linkCount(f os.FileInfo) string {
 	return ""
 }
 
+func fileDevice(f os.FileInfo) uint64 {
+	if stat, ok := f.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev)
+	}
+	return 0
+}
+
+func preserveOwner(path string, f os.FileInfo) error {
+	stat, ok := f.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	// changing the owner usually requires privileges so it is only done when permitted
+	if err := os.Lchown(path, int(stat.Uid), int(stat.Gid)); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	return nil
+}
+
+func preserveTimes(path string, f os.FileInfo) error {
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(times.Get(f).AccessTime().UnixNano()),
+		unix.NsecToTimespec(f.ModTime().UnixNano()),
+	}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
+
 func errCrossDevice(err error) bool {
 	return err.(*os.LinkError).Err.(unix.Errno) == unix.EXDEV
 }
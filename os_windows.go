@@ -1,6 +1,12 @@
 package main
 
-import "golang.org/x/sys/windows"
+import (
+	"io"
+
+	"github.com/djherbis/times"
+	"github.com/gdamore/tcell/v2"
+	"golang.org/x/sys/windows"
+)
 
 var (
 	envOpener = os.Getenv("OPENER")
@@ -15,14 +21,20 @@ var (
 	genDefaultSocketProt = "tcp"
 	genDefaultSocketPath = "127.0.0.1:12345"
 
+	// command to edit the file given as the first argument
+	genEditFileCmd = "%EDITOR%"
+
 	genUser        *user.User
 	genConfigPaths []string
 	genColorsPaths []string
 	genIconsPaths  []string
 	genFilesPath   string
 	genTagsPath    string
+	genSetsPath    string
 	genMarksPath   string
 	genHistoryPath string
+	genJournalPath string
+	genTrashPath   string
 )
 
 func init() {
@@ -71,7 +83,14 @@ func init() {
 	genFilesPath = filepath.Join(data, "fm", "files")
 	genMarksPath = filepath.Join(data, "fm", "marks")
 	genTagsPath = filepath.Join(data, "fm", "tags")
+	genSetsPath = filepath.Join(data, "fm", "selections")
 	genHistoryPath = filepath.Join(data, "fm", "history")
+	genJournalPath = filepath.Join(data, "fm", "journal")
+}
+
+func newScreen() (tcell.Screen, io.Writer, error) {
+	screen, err := tcell.NewScreen()
+	return screen, nil, err
 }
 
 func detachedCommand(name string, arg ...string) *exec.Cmd {
@@ -142,6 +161,21 @@ func linkCount(f os.FileInfo) string {
 	return ""
 }
 
+func fileDevice(f os.FileInfo) uint64 {
+	return 0
+}
+
+func preserveOwner(path string, f os.FileInfo) error {
+	return nil
+}
+
+func preserveTimes(path string, f os.FileInfo) error {
+	if f.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	return os.Chtimes(path, times.Get(f).AccessTime(), f.ModTime())
+}
+
 func errCrossDevice(err error) bool {
 	return err.(*os.LinkError).Err.(windows.Errno) == 17
 }
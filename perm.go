@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const modeSpecial = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// permClasses returns the permission bits of the classes in the given 'ugoa'
+// string, or all classes if the string is empty.
+func permClasses(who string) os.FileMode {
+	var mask os.FileMode
+	for _, c := range who {
+		switch c {
+		case 'u':
+			mask |= 0o700
+		case 'g':
+			mask |= 0o070
+		case 'o':
+			mask |= 0o007
+		case 'a':
+			mask |= 0o777
+		}
+	}
+	if mask == 0 {
+		mask = 0o777
+	}
+	return mask
+}
+
+// parseMode returns the given mode changed according to the given octal mode
+// such as '755' or symbolic mode such as 'u+x,go-w' as in chmod(1). Symbolic
+// modes without classes apply to all classes regardless of the umask.
+func parseMode(spec string, mode os.FileMode) (os.FileMode, error) {
+	if spec == "" {
+		return mode, errors.New("empty mode")
+	}
+
+	if spec[0] >= '0' && spec[0] <= '7' {
+		n, err := strconv.ParseUint(spec, 8, 32)
+		if err != nil || n > 0o7777 {
+			return mode, fmt.Errorf("invalid mode: %s", spec)
+		}
+
+		m := os.FileMode(n) & os.ModePerm
+		if n&0o4000 != 0 {
+			m |= os.ModeSetuid
+		}
+		if n&0o2000 != 0 {
+			m |= os.ModeSetgid
+		}
+		if n&0o1000 != 0 {
+			m |= os.ModeSticky
+		}
+
+		return mode&^(os.ModePerm|modeSpecial) | m, nil
+	}
+
+	for _, clause := range strings.Split(spec, ",") {
+		i := 0
+		for i < len(clause) && strings.IndexByte("ugoa", clause[i]) >= 0 {
+			i++
+		}
+		who := clause[:i]
+		mask := permClasses(who)
+
+		if i == len(clause) {
+			return mode, fmt.Errorf("invalid mode: %s", spec)
+		}
+
+		for i < len(clause) {
+			op := clause[i]
+			if op != '+' && op != '-' && op != '=' {
+				return mode, fmt.Errorf("invalid mode: %s", spec)
+			}
+			i++
+
+			// bits are computed for all classes and masked afterwards
+			var bits, special os.FileMode
+			if i < len(clause) && strings.IndexByte("ugo", clause[i]) >= 0 {
+				v := mode.Perm() & permClasses(clause[i:i+1])
+				for v > 0o7 {
+					v >>= 3
+				}
+				bits = v | v<<3 | v<<6
+				i++
+			} else {
+				for ; i < len(clause) && strings.IndexByte("rwxXst", clause[i]) >= 0; i++ {
+					switch clause[i] {
+					case 'r':
+						bits |= 0o444
+					case 'w':
+						bits |= 0o222
+					case 'x':
+						bits |= 0o111
+					case 'X':
+						if mode.IsDir() || mode&0o111 != 0 {
+							bits |= 0o111
+						}
+					case 's':
+						if mask&0o700 != 0 {
+							special |= os.ModeSetuid
+						}
+						if mask&0o070 != 0 {
+							special |= os.ModeSetgid
+						}
+					case 't':
+						if mask&0o007 != 0 {
+							special |= os.ModeSticky
+						}
+					}
+				}
+			}
+			bits &= mask
+
+			switch op {
+			case '+':
+				mode |= bits | special
+			case '-':
+				mode &^= bits | special
+			case '=':
+				mode &^= mask
+				if mask&0o700 != 0 {
+					mode &^= os.ModeSetuid
+				}
+				if mask&0o070 != 0 {
+					mode &^= os.ModeSetgid
+				}
+				if who == "" || strings.ContainsAny(who, "oa") {
+					mode &^= os.ModeSticky
+				}
+				mode |= bits | special
+			}
+		}
+	}
+
+	return mode, nil
+}
+
+// parseOwner returns the user and group ids of the given 'user[:group]' string
+// as in chown(1). Names and numeric ids are both accepted, and -1 is returned
+// for the ids that are not given.
+func parseOwner(spec string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+
+	name, group, _ := strings.Cut(spec, ":")
+	if name == "" && group == "" {
+		return uid, gid, fmt.Errorf("invalid owner: %s", spec)
+	}
+
+	if name != "" {
+		if uid, err = strconv.Atoi(name); err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return -1, -1, err
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return -1, -1, fmt.Errorf("%s: unsupported user id: %s", name, u.Uid)
+			}
+		}
+	}
+
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, err
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return -1, -1, fmt.Errorf("%s: unsupported group id: %s", group, g.Gid)
+			}
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// walkPaths calls the given function for each of the given paths, and for the
+// files inside them when recursive is true. Symbolic links inside directories
+// are passed to the function but not followed. All paths are visited even if
+// the function fails, and the first error is returned.
+func walkPaths(paths []string, recursive bool, fn func(path string, info os.FileInfo) error) error {
+	var first error
+	report := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			report(err)
+			continue
+		}
+
+		if !recursive || !info.IsDir() {
+			report(fn(path, info))
+			continue
+		}
+
+		// the given directory is walked even if it is a link
+		root, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			report(err)
+			continue
+		}
+
+		report(filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				report(err)
+				return nil
+			}
+			report(fn(p, info))
+			return nil
+		}))
+	}
+
+	return first
+}
+
+// chmodPaths changes the modes of the given files according to the given octal
+// or symbolic mode. Symbolic links inside directories are skipped as their
+// modes can not be changed.
+func chmodPaths(paths []string, spec string, recursive bool) error {
+	if _, err := parseMode(spec, 0); err != nil {
+		return err
+	}
+
+	return walkPaths(paths, recursive, func(path string, info os.FileInfo) error {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		mode, err := parseMode(spec, info.Mode())
+		if err != nil {
+			return err
+		}
+		return os.Chmod(path, mode&(os.ModePerm|modeSpecial))
+	})
+}
+
+// chownPaths changes the owners of the given files to the given 'user[:group]'.
+// Symbolic links are changed themselves rather than their targets.
+func chownPaths(paths []string, spec string, recursive bool) error {
+	uid, gid, err := parseOwner(spec)
+	if err != nil {
+		return err
+	}
+
+	return walkPaths(paths, recursive, func(path string, info os.FileInfo) error {
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// modeString returns the permission bits of the given mode similar to ls(1).
+func modeString(mode os.FileMode) string {
+	b := []byte("rwxrwxrwx")
+	for i := range b {
+		if mode&(1<<uint(8-i)) == 0 {
+			b[i] = '-'
+		}
+	}
+
+	special := func(i int, set bool, c byte) {
+		if !set {
+			return
+		}
+		if b[i] == 'x' {
+			b[i] = c
+		} else {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	special(2, mode&os.ModeSetuid != 0, 's')
+	special(5, mode&os.ModeSetgid != 0, 's')
+	special(8, mode&os.ModeSticky != 0, 't')
+
+	return string(b)
+}
+
+// chmodEditKeys are the keys used to toggle the bits of the permission editor.
+var chmodEditKeys = map[string]os.FileMode{
+	"1": 0o400, "2": 0o200, "3": 0o100,
+	"4": 0o040, "5": 0o020, "6": 0o010,
+	"7": 0o004, "8": 0o002, "9": 0o001,
+	"u": os.ModeSetuid, "g": os.ModeSetgid, "t": os.ModeSticky,
+}
+
+// reloadInfo reloads the information of the files after their modes or owners
+// are changed, since these changes do not modify the directories of the files.
+func (app *app) reloadInfo(name string) {
+	if genSingleMode {
+		if err := app.nav.reload(); err != nil {
+			app.ui.echoerrf("%s: %s", name, err)
+		}
+		app.ui.loadFile(app, true)
+		app.ui.loadFileInfo(app.nav)
+	} else if err := remote("send reload"); err != nil {
+		app.ui.echoerrf("%s: %s", name, err)
+	}
+}
+
+// chmodEdit opens the permission editor for the current file. Bits are toggled
+// with the keys shown in the menu and applied with 'cmd-enter', and the owner
+// is edited in a separate prompt.
+func (app *app) chmodEdit() error {
+	curr, err := app.nav.currFile()
+	if err != nil {
+		return err
+	}
+	if isArchivePath(curr.path) {
+		return errors.New("archives are read-only")
+	}
+
+	info, err := os.Stat(curr.path)
+	if err != nil {
+		return err
+	}
+
+	app.nav.chmodPath = curr.path
+	app.nav.chmodMode = info.Mode()
+	app.nav.chmodOwner = strings.TrimSpace(userName(info)) + ":" + strings.TrimSpace(groupName(info))
+	app.chmodEditShow()
+
+	return nil
+}
+
+func (app *app) chmodEditShow() {
+	app.ui.menuBuf = listPerms(app.nav.chmodMode, app.nav.chmodOwner)
+	app.ui.cmdPrefix = "chmod-edit: " + modeString(app.nav.chmodMode) + " "
+}
+
+// chmodEditKey handles a key pressed in the permission editor.
+func (app *app) chmodEditKey(key string) {
+	if key == "o" {
+		app.ui.menuBuf = nil
+		app.ui.cmdPrefix = "chown: "
+		app.ui.cmdAccLeft = []rune(app.nav.chmodOwner)
+		return
+	}
+
+	if bit, ok := chmodEditKeys[key]; ok {
+		app.nav.chmodMode ^= bit
+		app.chmodEditShow()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		spec string
+		mode os.FileMode
+		exp  os.FileMode
+		ok   bool
+	}{
+		{"755", 0o644, 0o755, true},
+		{"0600", 0o777, 0o600, true},
+		{"4755", 0o644, os.ModeSetuid | 0o755, true},
+		{"1777", os.ModeDir | 0o755, os.ModeDir | os.ModeSticky | 0o777, true},
+		{"u+x", 0o644, 0o744, true},
+		{"go-w", 0o666, 0o644, true},
+		{"a=r", 0o755, 0o444, true},
+		{"+x", 0o644, 0o755, true},
+		{"u=rwx,g=rx,o=", 0o777, 0o750, true},
+		{"g=u", 0o740, 0o770, true},
+		{"o+X", 0o644, 0o644, true},
+		{"o+X", os.ModeDir | 0o750, os.ModeDir | 0o751, true},
+		{"u+s,g+s", 0o755, os.ModeSetuid | os.ModeSetgid | 0o755, true},
+		{"+t", os.ModeDir | 0o777, os.ModeDir | os.ModeSticky | 0o777, true},
+		{"u=rw", os.ModeSetuid | 0o755, 0o655, true},
+		{"u+x-w", 0o644, 0o544, true},
+		{"", 0o644, 0o644, false},
+		{"888", 0o644, 0o644, false},
+		{"77777", 0o644, 0o644, false},
+		{"u", 0o644, 0o644, false},
+		{"u*x", 0o644, 0o644, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseMode(test.spec, test.mode)
+		if (err == nil) != test.ok {
+			t.Errorf("at input '%s' expected error '%t' but got '%v'", test.spec, !test.ok, err)
+			continue
+		}
+		if err == nil && got != test.exp {
+			t.Errorf("at input '%s' with mode '%v' expected '%v' but got '%v'", test.spec, test.mode, test.exp, got)
+		}
+	}
+}
+
+func TestModeString(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		exp  string
+	}{
+		{0o755, "rwxr-xr-x"},
+		{0o640, "rw-r-----"},
+		{os.ModeSetuid | 0o755, "rwsr-xr-x"},
+		{os.ModeSetgid | 0o745, "rwxr-Sr-x"},
+		{os.ModeSticky | 0o777, "rwxrwxrwt"},
+		{os.ModeSticky | 0o776, "rwxrwxrwT"},
+	}
+
+	for _, test := range tests {
+		if got := modeString(test.mode); got != test.exp {
+			t.Errorf("at input '%v' expected '%s' but got '%s'", test.mode, test.exp, got)
+		}
+	}
+}
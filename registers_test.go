@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegisterArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		exp  string
+		err  bool
+	}{
+		{nil, "", false},
+		{[]string{`"`}, "", false},
+		{[]string{"a"}, "a", false},
+		{[]string{"z"}, "z", false},
+		{[]string{"A"}, "", true},
+		{[]string{"ab"}, "", true},
+		{[]string{"1"}, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := registerArg(test.args)
+		if (err != nil) != test.err || got != test.exp {
+			t.Errorf("at input '%v' expected '%s' (error: %t) but got '%s' (%v)", test.args, test.exp, test.err, got, err)
+		}
+	}
+}
+
+func TestSaveRegister(t *testing.T) {
+	tmp := t.TempDir()
+
+	defer func(path string) { genFilesPath = path }(genFilesPath)
+	genFilesPath = filepath.Join(tmp, "fm", "files")
+
+	var paths []string
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(tmp, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	nav := &nav{selections: map[string]int{paths[0]: 0, paths[1]: 1}}
+	if _, err := nav.save("a", true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	nav.selections = map[string]int{paths[1]: 0, paths[2]: 1}
+	n, err := nav.save("a", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected '3' files in register but got '%d'", n)
+	}
+
+	list, cp, err := loadFiles("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp || !reflect.DeepEqual(list, paths) {
+		t.Errorf("expected files '%v' to copy but got '%v' (copy: %t)", paths, list, cp)
+	}
+
+	if _, err := nav.save("a", false, true); err == nil {
+		t.Errorf("appending files to move to a register holding files to copy should fail")
+	}
+
+	if list, _, err := loadFiles(""); err != nil || len(list) != 0 {
+		t.Errorf("unnamed register should be empty but got '%v' (%v)", list, err)
+	}
+	if len(nav.saves) != 0 {
+		t.Errorf("files in named registers should not be highlighted")
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// renameOp is a single rename performed by a bulk rename.
+type renameOp struct {
+	src string
+	dst string
+}
+
+// planRenames returns the renames needed to rename each of the given old paths
+// to the corresponding new path. Unchanged paths are skipped. Renames are
+// ordered so that chains such as 'a -> b, b -> c' rename 'b' first, and cycles
+// such as 'a -> b, b -> a' go through a temporary name. Existing files that are
+// not renamed themselves are only replaced when replace is true.
+func planRenames(olds, news []string, replace bool) ([]renameOp, error) {
+	if len(olds) != len(news) {
+		return nil, fmt.Errorf("expected %d names but got %d", len(olds), len(news))
+	}
+
+	srcs := make(map[string]bool)
+	for _, old := range olds {
+		srcs[filepath.Clean(old)] = true
+	}
+
+	// pending maps sources to destinations of renames that are not planned yet
+	pending := make(map[string]string)
+	dsts := make(map[string]string)
+
+	var order []string
+	for i, old := range olds {
+		src := filepath.Clean(old)
+		if news[i] == "" || strings.ContainsRune(news[i], '\n') {
+			return nil, fmt.Errorf("%s: invalid new name", src)
+		}
+
+		dst := filepath.Clean(news[i])
+		if prev, ok := dsts[dst]; ok {
+			return nil, fmt.Errorf("%s: duplicate target for %s and %s", dst, prev, src)
+		}
+		dsts[dst] = src
+
+		if dst == src {
+			continue
+		}
+
+		if _, err := os.Lstat(dst); err == nil && !srcs[dst] && !replace {
+			return nil, fmt.Errorf("%s: file exists", dst)
+		}
+
+		pending[src] = dst
+		order = append(order, src)
+	}
+
+	var ops []renameOp
+	for len(pending) != 0 {
+		progress := false
+		for _, src := range order {
+			dst, ok := pending[src]
+			if !ok {
+				continue
+			}
+			if _, ok := pending[dst]; ok {
+				continue
+			}
+			ops = append(ops, renameOp{src, dst})
+			delete(pending, src)
+			progress = true
+		}
+
+		if progress {
+			continue
+		}
+
+		// only cycles are left, so one file of a cycle is moved out of the way
+		for _, src := range order {
+			dst, ok := pending[src]
+			if !ok {
+				continue
+			}
+			tmp := numberedPath(filepath.Join(filepath.Dir(src), ".fm-rename-"+filepath.Base(src)))
+			ops = append(ops, renameOp{src, tmp})
+			delete(pending, src)
+			pending[tmp] = dst
+			order = append(order, tmp)
+			break
+		}
+	}
+
+	return ops, nil
+}
+
+// applyRenames performs the given renames in order. If a rename fails, the
+// previous renames are reverted so that files are not left with temporary
+// names.
+func applyRenames(ops []renameOp) error {
+	for i, op := range ops {
+		if err := os.Rename(op.src, op.dst); err != nil {
+			for k := i - 1; k >= 0; k-- {
+				os.Rename(ops[k].dst, ops[k].src)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bulkRename writes the names of the selected files, or all files in the
+// current directory if there are no selections, to a temporary file and opens
+// it in the editor. Files are then renamed to the edited names line by line.
+func (app *app) bulkRename() error {
+	dir := app.nav.currDir()
+
+	olds := app.nav.currSelections()
+	if len(olds) == 0 {
+		for _, f := range dir.files {
+			olds = append(olds, f.path)
+		}
+	}
+	if len(olds) == 0 {
+		return errors.New("no files to rename")
+	}
+	if err := checkArchivePaths(olds); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "fm-bulk-rename-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, old := range olds {
+		if strings.ContainsRune(old, '\n') {
+			tmp.Close()
+			return fmt.Errorf("%q: file names with newlines are not supported", old)
+		}
+		name, err := filepath.Rel(app.nav.fileDir(), old)
+		if err != nil {
+			name = old
+		}
+		fmt.Fprintln(tmp, name)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	app.runShell(genEditFileCmd, []string{tmp.Name()}, "$")
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var news []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		name := strings.TrimSuffix(s.Text(), "\r")
+		if !filepath.IsAbs(name) && name != "" {
+			name = filepath.Join(app.nav.fileDir(), name)
+		}
+		news = append(news, name)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	// trailing empty lines are usually added by editors
+	for len(news) > len(olds) && news[len(news)-1] == "" {
+		news = news[:len(news)-1]
+	}
+
+	ops, err := planRenames(olds, news, false)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		app.ui.echo("bulk-rename: nothing renamed")
+		return nil
+	}
+
+	if err := applyRenames(ops); err != nil {
+		return err
+	}
+
+	var srcs, dsts []string
+	for i, old := range olds {
+		if filepath.Clean(old) != filepath.Clean(news[i]) {
+			srcs = append(srcs, old)
+			dsts = append(dsts, filepath.Clean(news[i]))
+		}
+	}
+
+	app.nav.unselect()
+
+	app.ui.menuBuf = listRenames(srcs, dsts, dir.path)
+	app.ui.echof("Renamed %d files", len(srcs))
+
+	if err := journalRecord("rename", srcs, dsts); err != nil {
+		return fmt.Errorf("journal: %s", err)
+	}
+
+	return nil
+}
+
+var (
+	reRenameCounter  = regexp.MustCompile(`\{n(?::(\d+))?\}`)
+	reRenameSubmatch = regexp.MustCompile(`\$(\$|\d+)`)
+)
+
+// patternName returns the new name of the given file name by replacing the
+// matches of the given expression with the given replacement. Besides
+// submatches such as '$1', the replacement may contain the counter '{n}' or
+// '{n:W}' padded with zeros to width W, and '\U', '\L' and '\E' to convert the
+// following text to upper or lower case until the end of the conversion.
+func patternName(re *regexp.Regexp, repl, name string, n int) string {
+	// numbered submatches end at the last digit so that '$2_$1' does not refer
+	// to a submatch named '2_' as in regexp.Expand
+	repl = reRenameSubmatch.ReplaceAllStringFunc(repl, func(s string) string {
+		if s == "$$" {
+			return s
+		}
+		return "${" + s[1:] + "}"
+	})
+
+	repl = reRenameCounter.ReplaceAllStringFunc(repl, func(s string) string {
+		width, _ := strconv.Atoi(reRenameCounter.FindStringSubmatch(s)[1])
+		return fmt.Sprintf("%0*d", width, n)
+	})
+
+	// case conversions are marked with null characters that can not be part of
+	// file names so that they are not confused with the name itself
+	repl = strings.NewReplacer(`\U`, "\x00U", `\L`, "\x00L", `\E`, "\x00E").Replace(repl)
+
+	parts := strings.Split(re.ReplaceAllString(name, repl), "\x00")
+
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		switch part[0] {
+		case 'U':
+			b.WriteString(strings.ToUpper(part[1:]))
+		case 'L':
+			b.WriteString(strings.ToLower(part[1:]))
+		default:
+			b.WriteString(part[1:])
+		}
+	}
+
+	return b.String()
+}
+
+// patternRenames returns the paths of the given files whose names are changed
+// by the given expression and replacement along with their new paths. The
+// counter is incremented for each file whose name matches the expression.
+func patternRenames(re *regexp.Regexp, repl string, paths []string) (olds, news []string) {
+	n := 1
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if !re.MatchString(name) {
+			continue
+		}
+
+		newName := patternName(re, repl, name, n)
+		n++
+
+		if newName == name {
+			continue
+		}
+
+		olds = append(olds, path)
+		news = append(news, filepath.Join(filepath.Dir(path), newName))
+	}
+
+	return olds, news
+}
+
+// renamePatternCheck continues a pattern rename confirmed by the user. Similar
+// to 'rename', the user is asked to create missing directories and to replace
+// existing files before renaming.
+func (app *app) renamePatternCheck() {
+	olds, news := app.nav.renameOlds, app.nav.renameNews
+
+	srcs := make(map[string]bool)
+	for _, old := range olds {
+		srcs[old] = true
+	}
+
+	var dirs, existing int
+	for _, path := range news {
+		if _, err := os.Stat(filepath.Dir(path)); os.IsNotExist(err) {
+			dirs++
+		} else if _, err := os.Lstat(path); err == nil && !srcs[path] {
+			existing++
+		}
+	}
+
+	if dirs > 0 {
+		app.ui.cmdPrefix = "create directories for " + strconv.Itoa(dirs) + " files ? [y/N] "
+		return
+	}
+
+	if existing > 0 {
+		app.ui.cmdPrefix = "replace " + strconv.Itoa(existing) + " existing files ? [y/N] "
+		return
+	}
+
+	app.renamePatternApply()
+}
+
+// renamePatternApply renames the files of a pattern rename confirmed by the
+// user and refreshes the clients.
+func (app *app) renamePatternApply() {
+	olds, news := app.nav.renameOlds, app.nav.renameNews
+	app.nav.renameOlds, app.nav.renameNews = nil, nil
+
+	ops, err := planRenames(olds, news, true)
+	if err == nil {
+		err = applyRenames(ops)
+	}
+	if err != nil {
+		app.ui.echoerrf("rename-pattern: %s", err)
+		return
+	}
+
+	app.nav.unselect()
+
+	if err := journalRecord("rename", olds, news); err != nil {
+		app.ui.echoerrf("rename-pattern: journal: %s", err)
+	} else {
+		app.ui.echof("Renamed %d files", len(olds))
+	}
+
+	if genSingleMode {
+		app.nav.renew()
+		app.ui.loadFile(app, true)
+	} else {
+		if err := remote("send load"); err != nil {
+			app.ui.echoerrf("rename-pattern: %s", err)
+			return
+		}
+	}
+	app.ui.loadFile(app, true)
+	app.ui.loadFileInfo(app.nav)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestPlanRenames(t *testing.T) {
+	tests := []struct {
+		files []string
+		olds  []string
+		news  []string
+		exp   map[string]string
+	}{
+		{
+			[]string{"a", "b"},
+			[]string{"a", "b"},
+			[]string{"c", "b"},
+			map[string]string{"c": "a", "b": "b"},
+		},
+		{
+			[]string{"a", "b"},
+			[]string{"a", "b"},
+			[]string{"b", "c"},
+			map[string]string{"b": "a", "c": "b"},
+		},
+		{
+			[]string{"a", "b"},
+			[]string{"a", "b"},
+			[]string{"b", "a"},
+			map[string]string{"b": "a", "a": "b"},
+		},
+		{
+			[]string{"a", "b", "c"},
+			[]string{"a", "b", "c"},
+			[]string{"b", "c", "a"},
+			map[string]string{"b": "a", "c": "b", "a": "c"},
+		},
+		{
+			[]string{"a", "b"},
+			[]string{"a", "b"},
+			[]string{"c", "c"},
+			nil,
+		},
+		{
+			[]string{"a", "b"},
+			[]string{"a"},
+			[]string{"b"},
+			nil,
+		},
+		{
+			[]string{"a", "b"},
+			[]string{"a", "b"},
+			[]string{"a"},
+			nil,
+		},
+		{
+			[]string{"a"},
+			[]string{"a"},
+			[]string{""},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		tmp := t.TempDir()
+
+		join := func(names []string) []string {
+			var paths []string
+			for _, name := range names {
+				if name == "" {
+					paths = append(paths, "")
+				} else {
+					paths = append(paths, filepath.Join(tmp, name))
+				}
+			}
+			return paths
+		}
+
+		for _, name := range test.files {
+			if err := os.WriteFile(filepath.Join(tmp, name), []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ops, err := planRenames(join(test.olds), join(test.news), false)
+		if test.exp == nil {
+			if err == nil {
+				t.Errorf("at input '%v' and '%v' expected an error but got none", test.olds, test.news)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("at input '%v' and '%v' expected no error but got '%s'", test.olds, test.news, err)
+			continue
+		}
+
+		if err := applyRenames(ops); err != nil {
+			t.Errorf("at input '%v' and '%v' applying renames: %s", test.olds, test.news, err)
+			continue
+		}
+
+		names, err := readDirNames(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != len(test.exp) {
+			t.Errorf("at input '%v' and '%v' expected files '%v' but got '%v'", test.olds, test.news, test.exp, names)
+		}
+
+		for name, data := range test.exp {
+			b, err := os.ReadFile(filepath.Join(tmp, name))
+			if err != nil {
+				t.Errorf("at input '%v' and '%v' reading '%s': %s", test.olds, test.news, name, err)
+				continue
+			}
+			if string(b) != data {
+				t.Errorf("at input '%v' and '%v' expected file '%s' to have '%s' but got '%s'", test.olds, test.news, name, data, b)
+			}
+		}
+	}
+}
+
+func TestPatternName(t *testing.T) {
+	tests := []struct {
+		pattern string
+		repl    string
+		name    string
+		n       int
+		exp     string
+	}{
+		{`(\d+)_(.*)`, "$2_$1", "01_foo.txt", 1, "foo.txt_01"},
+		{`(\d+)_(.*)`, "${2}_$1", "01_foo.txt", 1, "foo.txt_01"},
+		{`(\d+)_(.*)`, "$$1_$2", "01_foo.txt", 1, "$1_foo.txt"},
+		{`\.jpeg$`, ".jpg", "foo.jpeg", 1, "foo.jpg"},
+		{`^`, "{n}_", "foo", 3, "3_foo"},
+		{`^.*$`, "img_{n:3}", "foo", 7, "img_007"},
+		{`^(\w)(\w*)`, `\U$1\E$2`, "foo bar", 1, "Foo bar"},
+		{`.*`, `\L$0`, "FOO.TXT", 1, "foo.txt"},
+		{`(.*)\.(.*)`, `\U$1\E.$2`, "foo.txt", 1, "FOO.txt"},
+		{`x`, "y", "foo", 1, "foo"},
+	}
+
+	for _, test := range tests {
+		re := regexp.MustCompile(test.pattern)
+		if got := patternName(re, test.repl, test.name, test.n); got != test.exp {
+			t.Errorf("at input '%s' with pattern '%s' and replacement '%s' expected '%s' but got '%s'",
+				test.name, test.pattern, test.repl, test.exp, got)
+		}
+	}
+}
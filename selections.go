@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// selectionSetPath returns the path of the file holding the selection set
+// with the given name. Each set is stored in its own file in the data
+// directory with one path per line in the order of selection.
+func selectionSetPath(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`+"\n") {
+		return "", fmt.Errorf("invalid selection set name: %s", name)
+	}
+	return filepath.Join(genSetsPath, name), nil
+}
+
+func readSelectionSet(name string) ([]string, error) {
+	path, err := selectionSetPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no selection set: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening selection set file: %s", err)
+	}
+	defer f.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if text := scanner.Text(); text != "" {
+			list = append(list, text)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading selection set file: %s", err)
+	}
+
+	return list, nil
+}
+
+func writeSelectionSet(name string, list []string) error {
+	path, err := selectionSetPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(genSetsPath, os.ModePerm); err != nil {
+		return fmt.Errorf("creating data directory: %s", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating selection set file: %s", err)
+	}
+	defer f.Close()
+
+	for _, p := range list {
+		if _, err := fmt.Fprintln(f, p); err != nil {
+			return fmt.Errorf("writing selection set file: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// selectionSetNames returns the names of the saved selection sets in sorted
+// order.
+func selectionSetNames() ([]string, error) {
+	entries, err := os.ReadDir(genSetsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading selection sets: %s", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// saveSelections saves all selected files to the selection set with the
+// given name in the order they were selected, replacing the set if it
+// already exists. It returns the number of files saved.
+func (nav *nav) saveSelections(name string) (int, error) {
+	if len(nav.selections) == 0 {
+		return 0, errors.New("no file selected")
+	}
+
+	var paths []string
+	var indices []int
+	for path, ind := range nav.selections {
+		paths = append(paths, path)
+		indices = append(indices, ind)
+	}
+	sort.Sort(indexedSelections{paths: paths, indices: indices})
+
+	if err := writeSelectionSet(name, paths); err != nil {
+		return 0, err
+	}
+
+	return len(paths), nil
+}
+
+// loadSelections replaces the current selections with the selection set with
+// the given name keeping the saved order. Files that no longer exist are left
+// out and returned so that the caller can warn about them.
+func (nav *nav) loadSelections(name string) (missing []string, err error) {
+	list, err := readSelectionSet(name)
+	if err != nil {
+		return nil, err
+	}
+
+	nav.unselect()
+	for _, path := range list {
+		if _, err := os.Lstat(path); err != nil {
+			missing = append(missing, path)
+			continue
+		}
+		if _, ok := nav.selections[path]; ok {
+			continue
+		}
+		nav.selections[path] = nav.selectionInd
+		nav.selectionInd++
+	}
+
+	return missing, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSelectionSetPath(t *testing.T) {
+	tests := []struct {
+		name string
+		err  bool
+	}{
+		{"photos", false},
+		{"my set", false},
+		{"", true},
+		{".", true},
+		{"..", true},
+		{"a/b", true},
+		{`a\b`, true},
+	}
+
+	for _, test := range tests {
+		if _, err := selectionSetPath(test.name); (err != nil) != test.err {
+			t.Errorf("at input '%s' expected error '%t' but got '%v'", test.name, test.err, err)
+		}
+	}
+}
+
+func TestSelectionSets(t *testing.T) {
+	tmp := t.TempDir()
+
+	defer func(path string) { genSetsPath = path }(genSetsPath)
+	genSetsPath = filepath.Join(tmp, "fm", "selections")
+
+	var paths []string
+	for _, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(tmp, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	nav := &nav{selections: map[string]int{paths[2]: 0, paths[0]: 1, paths[1]: 2}, selectionInd: 3}
+	if n, err := nav.saveSelections("set"); err != nil || n != 3 {
+		t.Fatalf("expected 3 files saved but got %d (%v)", n, err)
+	}
+
+	if err := os.Remove(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	nav.unselect()
+	missing, err := nav.loadSelections("set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{paths[0]}; !reflect.DeepEqual(missing, exp) {
+		t.Errorf("expected missing '%v' but got '%v'", exp, missing)
+	}
+	if exp := map[string]int{paths[2]: 0, paths[1]: 1}; !reflect.DeepEqual(nav.selections, exp) {
+		t.Errorf("expected selections '%v' but got '%v'", exp, nav.selections)
+	}
+	if nav.selectionInd != 2 {
+		t.Errorf("expected selection index '2' but got '%d'", nav.selectionInd)
+	}
+
+	if names, err := selectionSetNames(); err != nil || !reflect.DeepEqual(names, []string{"set"}) {
+		t.Errorf("expected names '[set]' but got '%v' (%v)", names, err)
+	}
+
+	if _, err := nav.loadSelections("none"); err == nil {
+		t.Error("expected error loading an unknown set")
+	}
+
+	nav.unselect()
+	if _, err := nav.saveSelections("empty"); err == nil {
+		t.Error("expected error saving without selections")
+	}
+}
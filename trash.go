@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pchchv/golog"
+)
+
+const trashTimeFormat = "2006-01-02T15:04:05"
+
+// trashDir is a trash directory as described in the FreeDesktop.org Trash
+// specification. Trashed files are kept in the 'files' subdirectory and the
+// information to restore them is kept in the 'info' subdirectory.
+type trashDir struct {
+	path string // path of the trash directory
+	top  string // top directory of the mount for per-mount trash directories, empty for the home trash
+}
+
+type trashItem struct {
+	dir          *trashDir
+	name         string    // name of the file in the 'files' subdirectory
+	path         string    // original absolute path of the file
+	deletionDate time.Time // time of the trash operation
+}
+
+func (t *trashDir) filesPath() string {
+	return filepath.Join(t.path, "files")
+}
+
+func (t *trashDir) infoPath() string {
+	return filepath.Join(t.path, "info")
+}
+
+func (t *trashDir) init() error {
+	if err := os.MkdirAll(t.filesPath(), 0o700); err != nil {
+		return err
+	}
+	return os.MkdirAll(t.infoPath(), 0o700)
+}
+
+// homeTrash returns the trash directory located in the data directory of the user.
+func homeTrash() (*trashDir, error) {
+	if genTrashPath == "" {
+		return nil, errors.New("trash is not supported on this platform")
+	}
+	return &trashDir{path: genTrashPath}, nil
+}
+
+// mountTop returns the top directory of the mount containing the given path.
+func mountTop(path string, dev uint64) string {
+	top := filepath.Dir(path)
+	for !isRoot(top) {
+		parent := filepath.Dir(top)
+		s, err := os.Lstat(parent)
+		if err != nil || fileDevice(s) != dev {
+			break
+		}
+		top = parent
+	}
+	return top
+}
+
+// trashDirFor returns the trash directory to be used for the given path.
+// Files on the same device as the home trash are trashed there, otherwise the
+// per-mount trash directory '$topdir/.Trash/$uid' is used when the
+// administrator has created '$topdir/.Trash' with the sticky bit set, and
+// '$topdir/.Trash-$uid' is used as a fallback. Directories are only created
+// when 'create' is true, otherwise nil is returned for missing directories.
+func trashDirFor(path string, create bool) (*trashDir, error) {
+	home, err := homeTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	lstat, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The home trash may not exist yet, in which case the nearest existing
+	// parent directory is used to find out its device.
+	hpath := home.path
+	hstat, err := os.Stat(hpath)
+	for os.IsNotExist(err) && !isRoot(hpath) {
+		hpath = filepath.Dir(hpath)
+		hstat, err = os.Stat(hpath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dev := fileDevice(lstat)
+	if dev == fileDevice(hstat) {
+		if create {
+			if err := home.init(); err != nil {
+				return nil, fmt.Errorf("creating trash directory: %s", err)
+			}
+		} else if _, err := os.Stat(home.path); err != nil {
+			return nil, nil
+		}
+		return home, nil
+	}
+
+	top := mountTop(path, dev)
+	uid := strconv.Itoa(os.Getuid())
+
+	admin := filepath.Join(top, ".Trash")
+	if s, err := os.Lstat(admin); err == nil && s.IsDir() && s.Mode()&os.ModeSticky != 0 {
+		t := &trashDir{path: filepath.Join(admin, uid), top: top}
+		if create {
+			if err := t.init(); err == nil {
+				return t, nil
+			}
+		} else if _, err := os.Stat(t.path); err == nil {
+			return t, nil
+		}
+	}
+
+	t := &trashDir{path: filepath.Join(top, ".Trash-"+uid), top: top}
+	if create {
+		if err := t.init(); err != nil {
+			return nil, fmt.Errorf("creating trash directory: %s", err)
+		}
+	} else if _, err := os.Stat(t.path); err != nil {
+		return nil, nil
+	}
+
+	return t, nil
+}
+
+// trashDirs returns the existing trash directories relevant for the given
+// directory, which are the home trash and the trash of the mount if any.
+func trashDirs(path string) []*trashDir {
+	var dirs []*trashDir
+
+	if home, err := homeTrash(); err == nil {
+		if _, err := os.Stat(home.path); err == nil {
+			dirs = append(dirs, home)
+		}
+	}
+
+	if t, err := trashDirFor(path, false); err == nil && t != nil && t.top != "" {
+		dirs = append(dirs, t)
+	}
+
+	return dirs
+}
+
+func encodeTrashPath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+// parseTrashInfo reads the original path and the deletion date from a
+// '.trashinfo' file.
+func parseTrashInfo(r io.Reader) (path string, date time.Time, err error) {
+	s := bufio.NewScanner(r)
+
+	header := false
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			header = line == "[Trash Info]"
+			continue
+		}
+		if !header {
+			continue
+		}
+
+		toks := strings.SplitN(line, "=", 2)
+		if len(toks) != 2 {
+			continue
+		}
+
+		switch toks[0] {
+		case "Path":
+			if path, err = url.PathUnescape(toks[1]); err != nil {
+				return "", time.Time{}, fmt.Errorf("decoding path: %s", err)
+			}
+		case "DeletionDate":
+			if date, err = time.ParseInLocation(trashTimeFormat, toks[1], time.Local); err != nil {
+				return "", time.Time{}, fmt.Errorf("parsing deletion date: %s", err)
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if path == "" {
+		return "", time.Time{}, errors.New("missing path")
+	}
+
+	return path, date, nil
+}
+
+// trash moves the given file to its trash directory and returns the new path
+// of the file inside the trash.
+func trash(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	t, err := trashDirFor(path, true)
+	if err != nil {
+		return "", err
+	}
+
+	orig := path
+	if t.top != "" {
+		if rel, err := filepath.Rel(t.top, path); err == nil {
+			orig = rel
+		}
+	}
+
+	base := filepath.Base(path)
+	name := base
+
+	var info *os.File
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(t.filesPath(), name)); os.IsNotExist(err) {
+			info, err = os.OpenFile(filepath.Join(t.infoPath(), name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+			if err == nil {
+				break
+			}
+			if !os.IsExist(err) {
+				return "", fmt.Errorf("creating trash info: %s", err)
+			}
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", encodeTrashPath(orig), time.Now().Format(trashTimeFormat))
+	if cerr := info.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(info.Name())
+		return "", fmt.Errorf("writing trash info: %s", err)
+	}
+
+	dst := filepath.Join(t.filesPath(), name)
+	if err := os.Rename(path, dst); err != nil {
+		os.Remove(info.Name())
+		return "", err
+	}
+
+	return dst, nil
+}
+
+// listTrash returns the items in the given trash directories starting from the
+// most recently trashed one.
+func listTrash(dirs []*trashDir) ([]*trashItem, error) {
+	var items []*trashItem
+
+	for _, t := range dirs {
+		names, err := filepath.Glob(filepath.Join(t.infoPath(), "*.trashinfo"))
+		if err != nil {
+			return nil, err
+		}
+
+		// other programs may leave malformed info files behind, which should
+		// not make the rest of the trash inaccessible
+		for _, n := range names {
+			f, err := os.Open(n)
+			if err != nil {
+				golog.Info("opening trash info: %s", err)
+				continue
+			}
+			path, date, err := parseTrashInfo(f)
+			f.Close()
+			if err != nil {
+				golog.Info("reading trash info: %s: %s", n, err)
+				continue
+			}
+
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(t.top, path)
+			}
+
+			items = append(items, &trashItem{
+				dir:          t,
+				name:         strings.TrimSuffix(filepath.Base(n), ".trashinfo"),
+				path:         path,
+				deletionDate: date,
+			})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].deletionDate.After(items[j].deletionDate)
+	})
+
+	return items, nil
+}
+
+func (item *trashItem) restore() error {
+	if _, err := os.Lstat(item.path); !os.IsNotExist(err) {
+		return fmt.Errorf("%s: file exists", item.path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(item.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(filepath.Join(item.dir.filesPath(), item.name), item.path); err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(item.dir.infoPath(), item.name+".trashinfo"))
+}
+
+// trashRestore restores the most recently trashed files with the given
+// original paths. Relative paths are interpreted relative to the given directory.
+func trashRestore(dir string, paths []string) error {
+	items, err := listTrash(trashDirs(dir))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		path = replaceTilde(path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		path = filepath.Clean(path)
+
+		var found *trashItem
+		for _, item := range items {
+			if item.path == path {
+				found = item
+				break
+			}
+		}
+
+		if found == nil {
+			return fmt.Errorf("%s: not found in trash", path)
+		}
+
+		if err := found.restore(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// empty permanently removes all files in the trash directory.
+func (t *trashDir) empty() error {
+	for _, dir := range []string{t.filesPath(), t.infoPath()} {
+		names, err := readDirNames(dir)
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			if err := os.RemoveAll(filepath.Join(dir, n)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func readDirNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Readdirnames(-1)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrashInfo(t *testing.T) {
+	tests := []struct {
+		s    string
+		path string
+		date time.Time
+		err  bool
+	}{
+		{"[Trash Info]\nPath=/home/user/foo\nDeletionDate=2004-08-31T22:32:08\n", "/home/user/foo", time.Date(2004, 8, 31, 22, 32, 8, 0, time.Local), false},
+		{"[Trash Info]\nPath=/home/user/foo%20bar\nDeletionDate=2004-08-31T22:32:08\n", "/home/user/foo bar", time.Date(2004, 8, 31, 22, 32, 8, 0, time.Local), false},
+		{"[Trash Info]\nPath=foo/bar\n", "foo/bar", time.Time{}, false},
+		{"# comment\n[Trash Info]\nPath=/foo\n[Other]\nPath=/bar\n", "/foo", time.Time{}, false},
+		{"[Other]\nPath=/foo\n", "", time.Time{}, true},
+		{"[Trash Info]\nPath=/foo%zz\n", "", time.Time{}, true},
+		{"[Trash Info]\nPath=/foo\nDeletionDate=yesterday\n", "", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		path, date, err := parseTrashInfo(strings.NewReader(test.s))
+		if (err != nil) != test.err {
+			t.Errorf("at input '%q' expected error '%t' but got '%v'", test.s, test.err, err)
+			continue
+		}
+		if path != test.path || !date.Equal(test.date) {
+			t.Errorf("at input '%q' expected '%s' '%v' but got '%s' '%v'", test.s, test.path, test.date, path, date)
+		}
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	tmp := t.TempDir()
+
+	defer func(path string) { genTrashPath = path }(genTrashPath)
+	genTrashPath = filepath.Join(tmp, "Trash")
+
+	dir := filepath.Join(tmp, "dir")
+	if err := os.Mkdir(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "foo bar")
+	for i := 0; i < 2; i++ {
+		if err := os.WriteFile(path, []byte{byte(i)}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := trash(path); err != nil {
+			t.Fatalf("trashing '%s': %s", path, err)
+		}
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Fatalf("trashed file '%s' still exists", path)
+		}
+	}
+
+	// malformed info files left by other programs are skipped
+	bad := filepath.Join(trashDirs(dir)[0].infoPath(), "bad.trashinfo")
+	if err := os.WriteFile(bad, []byte("garbage\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := listTrash(trashDirs(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 trashed items but got %d", len(items))
+	}
+	for _, item := range items {
+		if item.path != path {
+			t.Errorf("expected original path '%s' but got '%s'", path, item.path)
+		}
+	}
+
+	if err := trashRestore(dir, []string{"foo bar"}); err != nil {
+		t.Fatalf("restoring '%s': %s", path, err)
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Errorf("restored file '%s' does not exist: %s", path, err)
+	}
+	if err := trashRestore(dir, []string{"foo bar"}); err == nil {
+		t.Errorf("restoring over existing file '%s' should fail", path)
+	}
+
+	for _, td := range trashDirs(dir) {
+		if err := td.empty(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if items, _ := listTrash(trashDirs(dir)); len(items) != 0 {
+		t.Errorf("expected empty trash but got %d items", len(items))
+	}
+}
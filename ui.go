@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -181,9 +182,11 @@ type reg struct {
 
 type ui struct {
 	screen      tcell.Screen
+	tty         io.Writer // terminal of the screen, nil if not available
 	polling     bool
 	wins        []*win
 	promptWin   *win
+	progressWin *win
 	msgWin      *win
 	menuWin     *win
 	msg         string
@@ -201,6 +204,8 @@ type ui struct {
 	cmdTmp      []rune
 	keyAcc      []rune
 	keyCount    []rune
+	register    string // register given to the next command with 'register'
+
 	styles      styleMap
 	icons       iconMap
 	currentFile string
@@ -218,6 +223,7 @@ func newUI(screen tcell.Screen) *ui {
 		polling:     true,
 		wins:        getWins(screen),
 		promptWin:   newWin(wtot, 1, 0, 0),
+		progressWin: newWin(wtot, 1, 0, htot-2),
 		msgWin:      newWin(wtot, 1, 0, htot-1),
 		menuWin:     newWin(wtot, 1, 0, htot-2),
 		exprChan:    make(chan expr, 1000),
@@ -341,7 +347,7 @@ func (win *win) printDir(screen tcell.Screen, dir *dir, context *dirContext, dir
 		return
 	}
 
-	if dirStyle.previewing && genOpts.dirpreviews && len(genOpts.previewer) > 0 {
+	if _, _, ok := splitArchivePath(dir.path); dirStyle.previewing && genOpts.dirpreviews && len(genOpts.previewer) > 0 && !ok {
 		// print previewer result instead of default directory print operation.
 		st := tcell.StyleDefault
 		for i, l := range dir.lines {
@@ -400,7 +406,7 @@ func (win *win) printDir(screen tcell.Screen, dir *dir, context *dirContext, dir
 			win.print(screen, 0, i, tcell.StyleDefault.Foreground(LineNumberColor), ln)
 		}
 
-		path := filepath.Join(dir.path, f.Name())
+		path := f.path
 
 		if _, ok := context.selections[path]; ok {
 			win.print(screen, lnwidth, i, st.Background(SelectionColor), " ")
@@ -499,18 +505,21 @@ func (ui *ui) renew() {
 
 	widths := getWidths(wtot)
 
+	hwin := htot - progressBarHeight()
+
 	wacc := 0
 	wlen := len(widths)
 	for i := 0; i < wlen; i++ {
 		if genOpts.drawbox {
-			ui.wins[i].renew(widths[i], htot-4, wacc+1, 2)
+			ui.wins[i].renew(widths[i], hwin-4, wacc+1, 2)
 		} else {
-			ui.wins[i].renew(widths[i], htot-2, wacc, 1)
+			ui.wins[i].renew(widths[i], hwin-2, wacc, 1)
 		}
 		wacc += widths[i]
 	}
 
 	ui.promptWin.renew(wtot, 1, 0, 0)
+	ui.progressWin.renew(wtot, 1, 0, htot-2)
 	ui.msgWin.renew(wtot, 1, 0, htot-1)
 	ui.menuWin.renew(wtot, 1, 0, htot-2)
 }
@@ -540,6 +549,9 @@ func (ui *ui) loadFile(app *app, volatile bool) {
 	ui.currentFile = curr.path
 	onSelect(app)
 
+	// the previewed directory is watched as well
+	app.nav.updateWatches()
+
 	if !genOpts.preview {
 		return
 	}
@@ -548,7 +560,7 @@ func (ui *ui) loadFile(app *app, volatile bool) {
 		app.nav.previewChan <- ""
 	}
 
-	if curr.IsDir() {
+	if curr.browsable() {
 		ui.dirPrev = app.nav.loadDir(curr.path)
 	} else if curr.Mode().IsRegular() {
 		ui.regPrev = app.nav.loadReg(curr.path, volatile)
@@ -673,6 +685,9 @@ func (ui *ui) drawStatLine(nav *nav) {
 	tot := len(dir.files)
 	ind := min(dir.ind+1, tot)
 	acc := string(ui.keyCount) + string(ui.keyAcc)
+	if ui.register != "" {
+		acc = `"` + ui.register + acc
+	}
 
 	var selection string
 
@@ -705,17 +720,32 @@ func (ui *ui) drawStatLine(nav *nav) {
 
 	var progress string
 
+	// details are shown in the progress bar instead when it is enabled
+	bracket := func(s string, match func(j *job) bool) string {
+		if j := nav.jobs.find(match); j != nil && !genOpts.progressbar {
+			return fmt.Sprintf("  [%s %s]", s, j.details())
+		}
+		return fmt.Sprintf("  [%s]", s)
+	}
+
 	if nav.copyTotal > 0 {
 		percentage := int((100 * float64(nav.copyBytes)) / float64(nav.copyTotal))
-		progress += fmt.Sprintf("  [%d%%]", percentage)
+		progress += bracket(fmt.Sprintf("%d%%", percentage), func(j *job) bool {
+			_, _, isBytes := j.done()
+			return isBytes
+		})
 	}
 
 	if nav.moveTotal > 0 {
-		progress += fmt.Sprintf("  [%d/%d]", nav.moveCount, nav.moveTotal)
+		progress += bracket(fmt.Sprintf("%d/%d", nav.moveCount, nav.moveTotal), func(j *job) bool {
+			return j.kind == "move" || j.kind == "undo" || j.kind == "redo"
+		})
 	}
 
 	if nav.deleteTotal > 0 {
-		progress += fmt.Sprintf("  [%d/%d]", nav.deleteCount, nav.deleteTotal)
+		progress += bracket(fmt.Sprintf("%d/%d", nav.deleteCount, nav.deleteTotal), func(j *job) bool {
+			return j.kind == "delete" || j.kind == "trash"
+		})
 	}
 
 	ruler := fmt.Sprintf("%s%s%s  %d/%d", acc, progress, selection, ind, tot)
@@ -723,10 +753,42 @@ func (ui *ui) drawStatLine(nav *nav) {
 	ui.msgWin.printRight(ui.screen, 0, st, ruler)
 }
 
+// drawProgressBar draws the progress of the oldest running job with a known
+// total in the line above the status line.
+func (ui *ui) drawProgressBar(nav *nav) {
+	j := nav.jobs.find((*job).hasProgress)
+	if j == nil {
+		return
+	}
+
+	done, total, isBytes := j.done()
+	ratio := float64(done) / float64(total)
+	if ratio > 1 {
+		ratio = 1
+	}
+
+	amount := fmt.Sprintf("%d/%d", done, total)
+	if isBytes {
+		amount = humanize(done) + "/" + humanize(total)
+	}
+
+	prefix := j.kind + " "
+	info := fmt.Sprintf(" %3d%% %s %s", int(ratio*100), amount, j.details())
+
+	bar := ""
+	if width := ui.progressWin.w - printLength(prefix) - printLength(info) - 2; width >= 10 {
+		filled := int(ratio * float64(width))
+		bar = "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+	}
+
+	ui.progressWin.print(ui.screen, 0, 0, tcell.StyleDefault, prefix+bar+info)
+}
+
 func (ui *ui) drawBox() {
 	st := tcell.StyleDefault
 
 	w, h := ui.screen.Size()
+	h -= progressBarHeight()
 
 	for i := 1; i < w-1; i++ {
 		ui.screen.SetContent(i, 1, '─', nil, st)
@@ -790,6 +852,10 @@ func (ui *ui) draw(nav *nav) {
 		}
 	}
 
+	if genOpts.progressbar {
+		ui.drawProgressBar(nav)
+	}
+
 	switch ui.cmdPrefix {
 	case "":
 		ui.drawStatLine(nav)
@@ -820,7 +886,7 @@ func (ui *ui) draw(nav *nav) {
 		if err == nil {
 			preview := ui.wins[len(ui.wins)-1]
 
-			if curr.IsDir() {
+			if curr.browsable() {
 				preview.printDir(ui.screen, ui.dirPrev, &context,
 					&dirStyle{colors: ui.styles, icons: ui.icons, previewing: true})
 			} else if curr.Mode().IsRegular() {
@@ -894,6 +960,21 @@ func (ui *ui) pollEvent() tcell.Event {
 	}
 }
 
+// commands taking a register as their argument
+var registerCmds = map[string]bool{
+	"copy":                   true,
+	"cut":                    true,
+	"copy-append":            true,
+	"cut-append":             true,
+	"paste":                  true,
+	"paste-preview":          true,
+	"paste-symlink":          true,
+	"paste-relative-symlink": true,
+	"paste-hardlink":         true,
+	"clear":                  true,
+	"paste-from-clipboard":   true,
+}
+
 // This function is used to read a normal event on the client side. For keys,
 // digits are interpreted as command counts but this is only done for digits
 // preceding any non-digit characters (e.g. "42y2k" as 42 times "y2k").
@@ -941,6 +1022,7 @@ func (ui *ui) readNormalEvent(ev tcell.Event, nav *nav) expr {
 			ui.echoerrf("unknown mapping: %s", string(ui.keyAcc))
 			ui.keyAcc = nil
 			ui.keyCount = nil
+			ui.register = ""
 			ui.menuBuf = nil
 			return draw
 		default:
@@ -962,8 +1044,14 @@ func (ui *ui) readNormalEvent(ev tcell.Event, nav *nav) expr {
 					expr.(*listExpr).count = count
 				}
 
+				// the register is only used by the next command
+				if e, ok := expr.(*callExpr); ok && ui.register != "" && registerCmds[e.name] && len(e.args) == 0 {
+					expr = &callExpr{e.name, []string{ui.register}, e.count}
+				}
+
 				ui.keyAcc = nil
 				ui.keyCount = nil
+				ui.register = ""
 				ui.menuBuf = nil
 				return expr
 			}
@@ -1024,7 +1112,7 @@ func (ui *ui) readNormalEvent(ev tcell.Event, nav *nav) expr {
 			curr, err := nav.currFile()
 			if err != nil {
 				return nil
-			} else if !curr.IsDir() || genOpts.dirpreviews {
+			} else if !curr.browsable() || genOpts.dirpreviews {
 				if tev.Buttons() != tcell.Button2 {
 					return nil
 				}
@@ -1050,7 +1138,7 @@ func (ui *ui) readNormalEvent(ev tcell.Event, nav *nav) expr {
 			if tev.Buttons() == tcell.Button1 {
 				return sel
 			}
-			if file.IsDir() {
+			if file.browsable() {
 				return &callExpr{"cd", []string{file.path}, 1}
 			}
 			return &listExpr{[]expr{sel, &callExpr{"open", nil, 1}}, 1}
@@ -1143,7 +1231,7 @@ func fileInfo(f *file, d *dir) string {
 		case "size":
 			if !(f.IsDir() && genOpts.dircounts) {
 				var sz string
-				if f.IsDir() && f.dirSize < 0 {
+				if _, ok := f.dirTotal(); f.IsDir() && !ok {
 					sz = "-"
 				} else {
 					sz = humanize(f.TotalSize())
@@ -1173,6 +1261,10 @@ func fileInfo(f *file, d *dir) string {
 		}
 	}
 
+	if bar := duBar(f, d); bar != "" {
+		info = fmt.Sprintf("%s %s", info, bar)
+	}
+
 	return info
 }
 
@@ -1206,9 +1298,18 @@ func getWidths(wtot int) []int {
 	return widths
 }
 
+// progressBarHeight returns the number of lines taken by the progress bar.
+func progressBarHeight() int {
+	if genOpts.progressbar {
+		return 1
+	}
+	return 0
+}
+
 func getWins(screen tcell.Screen) []*win {
 	var wins []*win
 	wtot, htot := screen.Size()
+	htot -= progressBarHeight()
 
 	widths := getWidths(wtot)
 
@@ -1347,3 +1448,163 @@ func listMarks(marks map[string]string) *bytes.Buffer {
 
 	return b
 }
+
+// listRegisters returns the menu of the registers holding files, starting with
+// the unnamed register shown as '"'.
+func listRegisters() *bytes.Buffer {
+	t := new(tabwriter.Writer)
+	b := new(bytes.Buffer)
+
+	t.Init(b, 0, genOpts.tabstop, 2, '\t', 0)
+	fmt.Fprintln(t, "register\tmode\tfiles\tpaths")
+	for _, reg := range append([]string{""}, strings.Split("abcdefghijklmnopqrstuvwxyz", "")...) {
+		list, cp, err := loadFiles(reg)
+		if err != nil || len(list) == 0 {
+			continue
+		}
+
+		name, mode := reg, "move"
+		if name == "" {
+			name = `"`
+		}
+		if cp {
+			mode = "copy"
+		}
+
+		fmt.Fprintf(t, "%s\t%s\t%d\t%s\n", name, mode, len(list), strings.Join(list, " "))
+	}
+	t.Flush()
+
+	return b
+}
+
+func listSelectionSets(names []string) *bytes.Buffer {
+	t := new(tabwriter.Writer)
+	b := new(bytes.Buffer)
+
+	t.Init(b, 0, genOpts.tabstop, 2, '\t', 0)
+	fmt.Fprintln(t, "name\tfiles\tpaths")
+	for _, name := range names {
+		list, err := readSelectionSet(name)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(t, "%s\t%d\t%s\n", name, len(list), strings.Join(list, " "))
+	}
+	t.Flush()
+
+	return b
+}
+
+func listTrashItems(items []*trashItem) *bytes.Buffer {
+	t := new(tabwriter.Writer)
+	b := new(bytes.Buffer)
+
+	t.Init(b, 0, genOpts.tabstop, 2, '\t', 0)
+	fmt.Fprintln(t, "name\tdeleted")
+	for _, item := range items {
+		fmt.Fprintf(t, "%s\t%s\n", filepath.Base(item.path), item.deletionDate.Format(genOpts.timefmt))
+	}
+	t.Flush()
+
+	return b
+}
+
+func listJobs(jobs []*job) *bytes.Buffer {
+	t := new(tabwriter.Writer)
+	b := new(bytes.Buffer)
+
+	t.Init(b, 0, genOpts.tabstop, 2, '\t', 0)
+	fmt.Fprintln(t, "id\tjob\tstatus\tprogress\telapsed\tpath")
+	for _, j := range jobs {
+		status := "running"
+		if j.isPaused() {
+			status = "paused"
+		}
+
+		var progress []string
+		done, totalBytes, count, totalCount := j.progress()
+		if totalBytes > 0 {
+			percentage := int((100 * float64(done)) / float64(totalBytes))
+			progress = append(progress, fmt.Sprintf("%d%% (%s/%s)", percentage, humanize(done), humanize(totalBytes)))
+		}
+		if totalCount > 0 {
+			progress = append(progress, fmt.Sprintf("%d/%d", count, totalCount))
+		}
+
+		elapsed := time.Since(j.start).Round(time.Second)
+
+		fmt.Fprintf(t, "%d\t%s\t%s\t%s\t%s\t%s\n", j.id, j.kind, status, strings.Join(progress, " "), elapsed, j.path)
+	}
+	t.Flush()
+
+	return b
+}
+
+func listPasteItems(items []*pasteItem, dir string) *bytes.Buffer {
+	t := new(tabwriter.Writer)
+	b := new(bytes.Buffer)
+
+	t.Init(b, 0, genOpts.tabstop, 2, '\t', 0)
+	fmt.Fprintln(t, "status\tsize\tpath")
+	for _, item := range items {
+		status := item.status
+		if item.cross {
+			status += " (cross-device)"
+		}
+
+		path, err := filepath.Rel(dir, item.path)
+		if err != nil {
+			path = item.path
+		}
+
+		fmt.Fprintf(t, "%s\t%s\t%s\n", status, humanize(item.size), path)
+	}
+	t.Flush()
+
+	return b
+}
+
+func listRenames(srcs, dsts []string, dir string) *bytes.Buffer {
+	t := new(tabwriter.Writer)
+	b := new(bytes.Buffer)
+
+	rel := func(path string) string {
+		if r, err := filepath.Rel(dir, path); err == nil {
+			return r
+		}
+		return path
+	}
+
+	t.Init(b, 0, genOpts.tabstop, 2, '\t', 0)
+	fmt.Fprintln(t, "old\tnew")
+	for i, src := range srcs {
+		fmt.Fprintf(t, "%s\t%s\n", rel(src), rel(dsts[i]))
+	}
+	t.Flush()
+
+	return b
+}
+
+func listPerms(mode os.FileMode, owner string) *bytes.Buffer {
+	t := new(tabwriter.Writer)
+	b := new(bytes.Buffer)
+
+	bit := func(key string, c byte) string {
+		if mode&chmodEditKeys[key] == 0 {
+			c = '-'
+		}
+		return fmt.Sprintf("%s: %c", key, c)
+	}
+
+	t.Init(b, 0, genOpts.tabstop, 2, '\t', 0)
+	fmt.Fprintln(t, "class\tread\twrite\texecute")
+	fmt.Fprintf(t, "user\t%s\t%s\t%s\n", bit("1", 'r'), bit("2", 'w'), bit("3", 'x'))
+	fmt.Fprintf(t, "group\t%s\t%s\t%s\n", bit("4", 'r'), bit("5", 'w'), bit("6", 'x'))
+	fmt.Fprintf(t, "other\t%s\t%s\t%s\n", bit("7", 'r'), bit("8", 'w'), bit("9", 'x'))
+	fmt.Fprintf(t, "special\t%s\t%s\t%s\n", bit("u", 's'), bit("g", 's'), bit("t", 't'))
+	fmt.Fprintf(t, "owner\to: %s\n", owner)
+	t.Flush()
+
+	return b
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// watchDelay is how long to wait for further changes after a change in a
+	// watched directory before reloading it.
+	watchDelay = 100 * time.Millisecond
+
+	// watchMaxDelay is the longest time a reload can be postponed, so that
+	// directories which are changed constantly are still reloaded regularly.
+	watchMaxDelay = time.Second
+)
+
+// debounce collects the paths of changed directories from in and sends them to
+// out in batches once there have been no changes for watchDelay or changes
+// have been collected for watchMaxDelay. Each path is sent once per batch.
+func debounce(in <-chan string, out chan<- []string) {
+	var paths []string
+	pending := make(map[string]bool)
+	var deadline time.Time
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	flush := func() {
+		out <- paths
+		paths = nil
+		pending = make(map[string]bool)
+	}
+
+	for {
+		select {
+		case path, ok := <-in:
+			if !ok {
+				timer.Stop()
+				if len(paths) > 0 {
+					flush()
+				}
+				return
+			}
+
+			if len(paths) == 0 {
+				deadline = time.Now().Add(watchMaxDelay)
+			}
+			if !pending[path] {
+				pending[path] = true
+				paths = append(paths, path)
+			}
+
+			delay := watchDelay
+			if left := time.Until(deadline); left < delay {
+				delay = left
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(delay)
+		case <-timer.C:
+			if len(paths) > 0 {
+				flush()
+			}
+		}
+	}
+}
+
+// updateWatches watches the directories that are currently visible, which
+// are the directories in the panes and the previewed directory, and stops
+// watching the others. Watching is stopped altogether when the option 'watch'
+// is disabled, and disabled when watching is not possible, in which case
+// changes are only noticed by checking modification times. It is called when
+// the visible directories may have changed, rather than on every event.
+func (nav *nav) updateWatches() {
+	if !genOpts.watch {
+		if nav.watcher != nil {
+			nav.watcher.close()
+			nav.watcher = nil
+		}
+		return
+	}
+
+	// options may be set before any directory is loaded
+	if len(nav.dirs) == 0 {
+		return
+	}
+
+	if nav.watcher == nil {
+		events := make(chan string, 1024)
+		w, err := newWatcher(events)
+		if err != nil {
+			log.Printf("watching directories: %s", err)
+			genOpts.watch = false
+			return
+		}
+		nav.watcher = w
+		go debounce(events, nav.watchChan)
+	}
+
+	paths := make(map[string]bool)
+	for _, d := range nav.dirs {
+		paths[d.path] = true
+	}
+	if curr, err := nav.currFile(); err == nil && curr.IsDir() {
+		paths[curr.path] = true
+	}
+
+	nav.watcher.set(paths)
+}
+
+// watchReload reloads the loaded directories with the given paths after they
+// are reported to be changed by the watcher.
+func (nav *nav) watchReload(paths []string) {
+	for _, path := range paths {
+		var d *dir
+		for _, nd := range nav.dirs {
+			if nd.path == path {
+				d = nd
+				break
+			}
+		}
+		if d == nil {
+			d = nav.dirCache[path]
+		}
+		if d != nil {
+			nav.reloadDir(d)
+		}
+
+		// flat listings of the directory are walked again
+		for _, nd := range nav.dirs {
+			if l, ok := getListing(nd.path); ok && l.flat && l.dir == path {
+				touchListing(nd.path, true)
+				nav.reloadDir(nd)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask selects the inotify events that change the entries of a directory.
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR | unix.IN_EXCL_UNLINK
+
+// watcher reports changes of the entries of watched directories using inotify.
+type watcher struct {
+	fd     int
+	file   *os.File
+	events chan<- string
+	mutex  sync.Mutex
+	wds    map[int][]string
+	paths  map[string]int
+}
+
+// newWatcher returns a watcher sending the paths of changed directories to
+// events. The events channel is closed when the watcher is closed.
+func newWatcher(events chan<- string) (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("initializing inotify: %s", err)
+	}
+
+	// the descriptor is non-blocking so that reads go through the runtime
+	// poller and are interrupted when the file is closed
+	w := &watcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: events,
+		wds:    make(map[int][]string),
+		paths:  make(map[string]int),
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+// set watches the given directories and stops watching all others. Paths that
+// can not be watched, such as directories inside archives, are remembered so
+// that they are not tried again until they are no longer given.
+func (w *watcher) set(paths map[string]bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for path, wd := range w.paths {
+		if paths[path] {
+			continue
+		}
+		delete(w.paths, path)
+		if wd < 0 {
+			continue
+		}
+		if w.wds[wd] = removePath(w.wds[wd], path); len(w.wds[wd]) > 0 {
+			continue
+		}
+		delete(w.wds, wd)
+		if _, err := unix.InotifyRmWatch(w.fd, uint32(wd)); err != nil {
+			log.Printf("removing watch: %s", err)
+		}
+	}
+
+	for path := range paths {
+		if _, ok := w.paths[path]; ok {
+			continue
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			log.Printf("adding watch: %s", err)
+			w.paths[path] = -1
+			continue
+		}
+		// the same directory may be given with different paths via symlinks,
+		// in which case the watch is shared
+		w.wds[wd] = append(w.wds[wd], path)
+		w.paths[path] = wd
+	}
+}
+
+func removePath(paths []string, path string) []string {
+	for i, p := range paths {
+		if p == path {
+			return append(paths[:i], paths[i+1:]...)
+		}
+	}
+	return paths
+}
+
+func (w *watcher) close() {
+	if err := w.file.Close(); err != nil {
+		log.Printf("closing watcher: %s", err)
+	}
+}
+
+func (w *watcher) read() {
+	defer close(w.events)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("reading inotify events: %s", err)
+			}
+			return
+		}
+
+		var changed []string
+		w.mutex.Lock()
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+
+			switch {
+			case ev.Mask&unix.IN_Q_OVERFLOW != 0:
+				// events are lost, so everything is reloaded
+				for _, paths := range w.wds {
+					changed = append(changed, paths...)
+				}
+			case ev.Mask&unix.IN_IGNORED != 0:
+				// the directory is removed or unmounted
+				for _, path := range w.wds[int(ev.Wd)] {
+					delete(w.paths, path)
+				}
+				delete(w.wds, int(ev.Wd))
+			default:
+				changed = append(changed, w.wds[int(ev.Wd)]...)
+			}
+		}
+		w.mutex.Unlock()
+
+		// paths are sent without holding the lock as sending may block until
+		// the main loop handles earlier changes
+		for _, path := range changed {
+			w.events <- path
+		}
+	}
+}
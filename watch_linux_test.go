@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+
+	events := make(chan string, 16)
+	w, err := newWatcher(events)
+	if err != nil {
+		t.Skipf("inotify is not available: %s", err)
+	}
+	w.set(map[string]bool{dir: true, filepath.Join(dir, "missing"): true})
+
+	expect := func(name string) {
+		t.Helper()
+		select {
+		case path := <-events:
+			if path != dir {
+				t.Errorf("at %s expected '%s' but got '%s'", name, dir, path)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("at %s expected a change of '%s'", name, dir)
+		}
+	}
+
+	file := filepath.Join(dir, "a")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect("create")
+
+	if err := os.Rename(file, filepath.Join(dir, "b")); err != nil {
+		t.Fatal(err)
+	}
+	expect("rename")
+	expect("rename")
+
+	w.set(map[string]bool{})
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w.close()
+	for path := range events {
+		t.Errorf("expected no changes after removing the watch but got '%s'", path)
+	}
+}
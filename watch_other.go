@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// watcher is not implemented on this platform, so changes of directories are
+// only noticed by checking modification times.
+type watcher struct{}
+
+func newWatcher(events chan<- string) (*watcher, error) {
+	return nil, errors.New("not supported on this platform")
+}
+
+func (w *watcher) set(paths map[string]bool) {}
+
+func (w *watcher) close() {}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	in := make(chan string)
+	out := make(chan []string, 10)
+	go debounce(in, out)
+
+	in <- "/a"
+	in <- "/b"
+	in <- "/a"
+
+	select {
+	case paths := <-out:
+		if exp := []string{"/a", "/b"}; !reflect.DeepEqual(paths, exp) {
+			t.Errorf("expected '%v' but got '%v'", exp, paths)
+		}
+	case <-time.After(5 * watchMaxDelay):
+		t.Fatal("expected changes to be sent")
+	}
+
+	// changes arriving faster than the delay are still sent regularly
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for time.Since(start) < 2*watchMaxDelay {
+			in <- "/c"
+			time.Sleep(watchDelay / 4)
+		}
+	}()
+
+	select {
+	case paths := <-out:
+		if exp := []string{"/c"}; !reflect.DeepEqual(paths, exp) {
+			t.Errorf("expected '%v' but got '%v'", exp, paths)
+		}
+	case <-time.After(2 * watchMaxDelay):
+		t.Error("expected changes of a busy directory to be sent")
+	}
+	<-done
+
+	close(in)
+}